@@ -0,0 +1,96 @@
+package main
+
+import (
+	"fmt"
+	"os"
+	"sync/atomic"
+	"time"
+
+	"k8s.io/client-go/rest"
+)
+
+const errorThresholdCheck = "error threshold"
+
+// errorSample is the request counters at one point of the error window.
+type errorSample struct {
+	requests, failures int64
+}
+
+// abortOnErrors stops the run with a non-zero exit code once the failures
+// within the last errorWindow exceed maxErrors or maxErrorRate percent of
+// the requests, deleting the generated objects first if cleanOnAbort is set.
+func abortOnErrors(config *rest.Config, resourceType string) {
+	// the first sample is taken at the start, so the failures of the first
+	// second count too
+	samples := []errorSample{sampleErrors()}
+	ticker := time.NewTicker(time.Second)
+	defer ticker.Stop()
+	for range ticker.C {
+		samples = append(samples, sampleErrors())
+		if window := int(errorWindow / time.Second); len(samples) > window+1 {
+			samples = samples[len(samples)-window-1:]
+		}
+		first, last := samples[0], samples[len(samples)-1]
+		requests, failures := last.requests-first.requests, last.failures-first.failures
+		if (maxErrors > 0 && failures > int64(maxErrors)) ||
+			(maxErrorRate > 0 && requests > 0 && float64(failures)*100/float64(requests) > maxErrorRate) {
+			// like a signal, keep main from reporting the run at the same time
+			finishing.Lock()
+			msg := fmt.Sprintf("%d of %d requests failed within %s", failures, requests, errorWindow)
+			fmt.Fprintf(out, "aborting: %s\n", msg)
+			addCheck(errorThresholdCheck, false, msg)
+			sendFinalStats(false)
+			showStatus()
+			writeReport(config)
+			if cleanOnAbort {
+				cleanRun(config, resourceType)
+			}
+			runPostRunHook(false)
+			os.Exit(1)
+		}
+	}
+}
+
+func sampleErrors() errorSample {
+	failures := atomic.LoadInt64(&counterFailure)
+	return errorSample{
+		requests: atomic.LoadInt64(&counterSuccess) + failures + atomic.LoadInt64(&counterOversized),
+		failures: failures,
+	}
+}
+
+// cleanRun runs the 'clean' action for the objects of the run. Every
+// replica cleans up its own run, only a clean of -allRuns is left to the
+// leader.
+func cleanRun(config *rest.Config, resourceType string) {
+	if runPrefix == "" && !allRuns {
+		runPrefix = runName()
+	}
+	leader := true
+	if allRuns {
+		var err error
+		if leader, err = waitForLeader(); err != nil {
+			fmt.Fprintf(out, "clean failed: %s\n", err)
+			return
+		}
+	}
+	if !leader {
+		fmt.Fprintf(out, "leaving 'clean' to the leader %s\n", leaderName())
+	} else if templateName != "" {
+		cleanTemplateObjects(config, templateName)
+	} else if err := cleanup(config, resourceType); err != nil {
+		fmt.Fprintf(out, "clean failed: %s\n", err)
+	}
+}
+
+// failRun ends a run the action could not complete, with its check failed
+// and the run reported.
+func failRun(config *rest.Config, action string, err error) {
+	fmt.Fprintf(out, "%s failed: %s\n", action, err)
+	addCheck(action, false, err.Error())
+	sendFinalStats(false)
+	showStatus()
+	writeReport(config)
+	runPostRunHook(false)
+	os.Exit(1)
+}
@@ -0,0 +1,173 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"strings"
+	"sync"
+	"time"
+
+	"cpburner/pkg/burner"
+	admissionv1 "k8s.io/api/admissionregistration/v1"
+	apiv1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/client-go/kubernetes"
+	"k8s.io/client-go/rest"
+)
+
+const (
+	admissionStageLabel      = "cpburner/admission-stage"
+	admissionStageNone       = "none"
+	admissionStageMutating   = "mutating"
+	admissionStageValidating = "validating"
+	admissionWebhookName     = "cpburner.admission.cpburner.io"
+	admissionPropagation     = 5 * time.Second
+	admissionTimeoutSecs     = int32(10)
+)
+
+var admissionStages = []string{admissionStageNone, admissionStageMutating, admissionStageValidating}
+
+// admissionBreakdown runs identical creates in three namespaces: one matched
+// by no webhook, one only by a mutating and one only by a validating webhook.
+// cpburner creates the namespaces and the webhook configurations itself, so
+// it controls which namespace each webhook selects; the webhook backend is
+// the one given by -webhookURL or -webhookService. The difference to the
+// namespace without webhooks is the marginal latency of each admission stage.
+func admissionBreakdown(config *rest.Config, resourceCount int, resourceType string) {
+	ctx := context.Background()
+	clientset, err := kubernetes.NewForConfig(config)
+	if err != nil {
+		panic(err)
+	}
+	clientConfig, err := webhookClientConfig()
+	if err != nil {
+		panic(err)
+	}
+
+	namespaces := map[string]string{}
+	for _, stage := range admissionStages {
+		ns, err := clientset.CoreV1().Namespaces().Create(ctx, &apiv1.Namespace{
+			ObjectMeta: metav1.ObjectMeta{
+				Name:   fmt.Sprintf("%s-admission-%s", globalPrefix, stage),
+				Labels: map[string]string{admissionStageLabel: stage},
+			},
+		}, metav1.CreateOptions{})
+		if err != nil {
+			panic(err)
+		}
+		namespaces[stage] = ns.Name
+		defer clientset.CoreV1().Namespaces().Delete(ctx, ns.Name, metav1.DeleteOptions{})
+	}
+
+	spec := burner.Generator(resourceType).Spec()
+	sideEffects := admissionv1.SideEffectClassNone
+	failurePolicy := admissionv1.Fail
+	timeoutSeconds := admissionTimeoutSecs
+	rules := []admissionv1.RuleWithOperations{{
+		Operations: []admissionv1.OperationType{admissionv1.Create},
+		Rule:       admissionv1.Rule{APIGroups: []string{spec.Group}, APIVersions: []string{spec.Version}, Resources: []string{spec.Resource}},
+	}}
+	selector := func(stage string) *metav1.LabelSelector {
+		return &metav1.LabelSelector{MatchLabels: map[string]string{admissionStageLabel: stage}}
+	}
+	mutating, err := clientset.AdmissionregistrationV1().MutatingWebhookConfigurations().Create(ctx, &admissionv1.MutatingWebhookConfiguration{
+		ObjectMeta: metav1.ObjectMeta{Name: globalPrefix + "-mutating"},
+		Webhooks: []admissionv1.MutatingWebhook{{
+			Name:                    admissionWebhookName,
+			ClientConfig:            clientConfig,
+			Rules:                   rules,
+			NamespaceSelector:       selector(admissionStageMutating),
+			SideEffects:             &sideEffects,
+			FailurePolicy:           &failurePolicy,
+			TimeoutSeconds:          &timeoutSeconds,
+			AdmissionReviewVersions: []string{"v1"},
+		}},
+	}, metav1.CreateOptions{})
+	if err != nil {
+		panic(err)
+	}
+	defer clientset.AdmissionregistrationV1().MutatingWebhookConfigurations().Delete(ctx, mutating.Name, metav1.DeleteOptions{})
+	validating, err := clientset.AdmissionregistrationV1().ValidatingWebhookConfigurations().Create(ctx, &admissionv1.ValidatingWebhookConfiguration{
+		ObjectMeta: metav1.ObjectMeta{Name: globalPrefix + "-validating"},
+		Webhooks: []admissionv1.ValidatingWebhook{{
+			Name:                    admissionWebhookName,
+			ClientConfig:            clientConfig,
+			Rules:                   rules,
+			NamespaceSelector:       selector(admissionStageValidating),
+			SideEffects:             &sideEffects,
+			FailurePolicy:           &failurePolicy,
+			TimeoutSeconds:          &timeoutSeconds,
+			AdmissionReviewVersions: []string{"v1"},
+		}},
+	}, metav1.CreateOptions{})
+	if err != nil {
+		panic(err)
+	}
+	defer clientset.AdmissionregistrationV1().ValidatingWebhookConfigurations().Delete(ctx, validating.Name, metav1.DeleteOptions{})
+	fmt.Fprintf(out, "waiting %s for the webhook configurations to reach the apiservers\n", admissionPropagation)
+	time.Sleep(admissionPropagation)
+
+	stats := map[string]*latencyStats{}
+	for _, stage := range admissionStages {
+		stats[stage] = createInNamespace(ctx, config, resourceCount, resourceType, namespaces[stage])
+		fmt.Fprintf(out, "admission %s: %s\n", stage, stats[stage])
+	}
+	base := stats[admissionStageNone].mean()
+	for _, stage := range []string{admissionStageMutating, admissionStageValidating} {
+		fmt.Fprintf(out, "marginal %s admission latency: %s\n", stage, stats[stage].mean()-base)
+	}
+}
+
+func createInNamespace(ctx context.Context, config *rest.Config, resourceCount int, resourceType string, namespace string) *latencyStats {
+	stats := &latencyStats{}
+	wg := sync.WaitGroup{}
+	count := int(resourceCount / concurrency)
+	for i := 0; i < concurrency; i++ {
+		wg.Add(1)
+		go func(prefix string) {
+			defer wg.Done()
+			clientset, err := kubernetes.NewForConfig(workerConfig(config))
+			if err != nil {
+				panic(err)
+			}
+			for j := 0; j < count; j++ {
+				name := objectName(prefix, j)
+				start := time.Now()
+				wctx, cancel := writeContext(ctx)
+				meta := generatedMeta(name)
+				meta.Namespace = namespace
+				ref := involvedObject(name)
+				ref.Namespace = namespace
+				err = burner.Generator(resourceType).Create(wctx, clientset, burner.Object{Meta: meta, Payload: payload(name), InvolvedObject: ref}, createOptions())
+				cancel()
+				stats.observe(time.Since(start), err)
+				record(verbCreate, resourceName(resourceType), start, err)
+			}
+		}(fmt.Sprintf("%s-%d", globalPrefix, i))
+	}
+	wg.Wait()
+	return stats
+}
+
+func webhookClientConfig() (admissionv1.WebhookClientConfig, error) {
+	c := admissionv1.WebhookClientConfig{}
+	if webhookCAFile != "" {
+		ca, err := os.ReadFile(webhookCAFile)
+		if err != nil {
+			return c, err
+		}
+		c.CABundle = ca
+	}
+	if webhookURL != "" {
+		c.URL = &webhookURL
+		return c, nil
+	}
+	parts := strings.SplitN(webhookService, "/", 2)
+	if len(parts) != 2 {
+		return c, fmt.Errorf("-webhookService must be namespace/name, got %q", webhookService)
+	}
+	path := webhookPath
+	c.Service = &admissionv1.ServiceReference{Namespace: parts[0], Name: parts[1], Path: &path}
+	return c, nil
+}
@@ -0,0 +1,119 @@
+package main
+
+import (
+	"fmt"
+	"io"
+	"net/http"
+	"sort"
+	"strconv"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+// response headers naming the flow schema and priority level API Priority
+// and Fairness classified a request into
+const (
+	headerFlowSchemaUID    = "X-Kubernetes-PF-FlowSchema-UID"
+	headerPriorityLevelUID = "X-Kubernetes-PF-PriorityLevel-UID"
+)
+
+type apfKey struct {
+	flowSchemaUID, priorityLevelUID string
+}
+
+var (
+	apfMu sync.Mutex
+	// responses by the flow schema and priority level they were served in
+	apfCounts = map[apfKey]int64{}
+)
+
+// apfUsage is how many responses came from one flow schema and priority
+// level. Names are resolved through the cluster inventory.
+type apfUsage struct {
+	FlowSchema       string `json:"flowSchema,omitempty"`
+	FlowSchemaUID    string `json:"flowSchemaUID"`
+	PriorityLevel    string `json:"priorityLevel,omitempty"`
+	PriorityLevelUID string `json:"priorityLevelUID"`
+	Requests         int64  `json:"requests"`
+}
+
+// apfRecorder counts the APF headers of the responses to every client built
+// from the config it wraps.
+type apfRecorder struct {
+	next http.RoundTripper
+}
+
+func (r *apfRecorder) RoundTrip(req *http.Request) (*http.Response, error) {
+	resp, err := r.next.RoundTrip(req)
+	if err != nil {
+		return nil, err
+	}
+	key := apfKey{resp.Header.Get(headerFlowSchemaUID), resp.Header.Get(headerPriorityLevelUID)}
+	if key.flowSchemaUID != "" || key.priorityLevelUID != "" {
+		apfMu.Lock()
+		apfCounts[key]++
+		apfMu.Unlock()
+	}
+	if resp.StatusCode == http.StatusTooManyRequests {
+		// client-go retries these itself, so each try is seen here
+		atomic.AddInt64(&counterThrottled, 1)
+		if seconds, err := strconv.Atoi(resp.Header.Get("Retry-After")); err == nil {
+			retryAfter.observe(time.Duration(seconds) * time.Second)
+		}
+	}
+	return resp, nil
+}
+
+var (
+	// 429 responses, including those client-go retried
+	counterThrottled int64
+	// delays advised by the Retry-After header of 429 responses
+	retryAfter histogram
+)
+
+func printThrottling(w io.Writer) {
+	if n := atomic.LoadInt64(&counterThrottled); n > 0 {
+		fmt.Fprintf(w, "  throttled responses: %d, Retry-After: %s\n", n, &retryAfter)
+	}
+}
+
+func apfUsages() []apfUsage {
+	schemas, levels := map[string]string{}, map[string]string{}
+	if report.Cluster != nil {
+		for _, fs := range report.Cluster.FlowSchemas {
+			schemas[fs.UID] = fs.Name
+		}
+		for _, pl := range report.Cluster.PriorityLevels {
+			levels[pl.UID] = pl.Name
+		}
+	}
+	apfMu.Lock()
+	defer apfMu.Unlock()
+	usages := []apfUsage{}
+	for key, n := range apfCounts {
+		usages = append(usages, apfUsage{
+			FlowSchema:       schemas[key.flowSchemaUID],
+			FlowSchemaUID:    key.flowSchemaUID,
+			PriorityLevel:    levels[key.priorityLevelUID],
+			PriorityLevelUID: key.priorityLevelUID,
+			Requests:         n,
+		})
+	}
+	sort.Slice(usages, func(i, j int) bool { return usages[i].Requests > usages[j].Requests })
+	return usages
+}
+
+func printAPFUsages(w io.Writer) {
+	for _, u := range apfUsages() {
+		fmt.Fprintf(w, "  flow schema %s, priority level %s: %d requests\n",
+			nameOrUID(u.FlowSchema, u.FlowSchemaUID), nameOrUID(u.PriorityLevel, u.PriorityLevelUID), u.Requests)
+	}
+}
+
+func nameOrUID(name string, uid string) string {
+	if name != "" {
+		return name
+	}
+	return uid
+}
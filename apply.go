@@ -0,0 +1,64 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"sync"
+	"time"
+
+	"cpburner/pkg/burner"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/client-go/kubernetes"
+	"k8s.io/client-go/rest"
+)
+
+// apply server-side applies every object once per field manager. Each manager
+// owns its own annotation, so the managedFields of every object grow to
+// fieldManagers entries, and manager 0 additionally owns the payload.
+func apply(config *rest.Config, resourceCount int, resourceType string) {
+	ctx := context.Background()
+	wg := sync.WaitGroup{}
+	count := int(resourceCount / concurrency)
+	for i := 0; i < concurrency; i++ {
+		wg.Add(1)
+		go func(prefix string) {
+			defer wg.Done()
+			clientset, err := kubernetes.NewForConfig(workerConfig(config))
+			if err != nil {
+				panic(err)
+			}
+			applyObjects(ctx, clientset, resourceType, prefix, count)
+		}(fmt.Sprintf("%s-%d", globalPrefix, i))
+	}
+	wg.Wait()
+}
+
+func fieldManagerName(m int) string {
+	return fmt.Sprintf("cpburner-%d", m)
+}
+
+func fieldManagerAnnotations(m int) map[string]string {
+	return map[string]string{fmt.Sprintf("cpburner/field-manager-%d", m): fieldManagerName(m)}
+}
+
+func applyObjects(ctx context.Context, clientset *kubernetes.Clientset, resourceType string, namePrefix string, count int) {
+	generator := burner.Generator(resourceType)
+	issue(count, func(i int) {
+		name := objectName(namePrefix, i)
+		for m := 0; m < fieldManagers; m++ {
+			obj := burner.Object{Meta: metav1.ObjectMeta{Name: name, Namespace: namespaceOf(name), Annotations: fieldManagerAnnotations(m)}}
+			if m == 0 {
+				obj.Meta.Labels, obj.Meta.Finalizers = generatedLabels(), generatedFinalizers()
+				for k, v := range generatedAnnotations() {
+					obj.Meta.Annotations[k] = v
+				}
+				obj.Payload, obj.InvolvedObject = payload(name), involvedObject(name)
+			}
+			start := time.Now()
+			wctx, cancel := writeContext(ctx)
+			err := generator.Apply(wctx, clientset, obj, applyOptions(fieldManagerName(m)))
+			cancel()
+			record(verbApply, resourceName(resourceType), start, err)
+		}
+	})
+}
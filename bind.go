@@ -0,0 +1,76 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"sync"
+	"time"
+
+	apiv1 "k8s.io/api/core/v1"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/client-go/kubernetes"
+	"k8s.io/client-go/rest"
+)
+
+// bindPods emulates scheduler write traffic: every worker creates its share
+// of resourceCount pending pods, then binds each of them to one of
+// bindNodes fake nodes and finally deletes them. The nodes do not exist, so
+// no kubelet ever runs the pods, and the pod garbage collector may delete
+// some of them before cpburner does.
+func bindPods(config *rest.Config, resourceCount int) {
+	ctx := context.Background()
+	createStats := &latencyStats{}
+	bindStats := &latencyStats{}
+	wg := sync.WaitGroup{}
+	count := int(resourceCount / concurrency)
+	for i := 0; i < concurrency; i++ {
+		wg.Add(1)
+		go func(prefix string) {
+			defer wg.Done()
+			clientset, err := kubernetes.NewForConfig(workerConfig(config))
+			if err != nil {
+				panic(err)
+			}
+			names := []string{}
+			for j := 0; j < count; j++ {
+				name := objectName(prefix, j)
+				start := time.Now()
+				wctx, cancel := writeContext(ctx)
+				pod, err := clientset.CoreV1().Pods(namespaceOf(name)).Create(wctx, newPendingPod(name), createOptions())
+				cancel()
+				createStats.observe(time.Since(start), err)
+				record(verbCreate, "pods", start, err)
+				if err != nil {
+					continue
+				}
+				names = append(names, pod.Name)
+			}
+			for j, name := range names {
+				binding := &apiv1.Binding{
+					ObjectMeta: metav1.ObjectMeta{Name: name},
+					Target:     apiv1.ObjectReference{Kind: "Node", Name: fakeNodeName(j)},
+				}
+				start := time.Now()
+				wctx, cancel := writeContext(ctx)
+				err := clientset.CoreV1().Pods(namespaceOf(name)).Bind(wctx, binding, createOptions())
+				cancel()
+				bindStats.observe(time.Since(start), err)
+				record(verbCreate, "pods/binding", start, err)
+			}
+			for _, name := range names {
+				if err := clientset.CoreV1().Pods(namespaceOf(name)).Delete(ctx, name, deleteOptions()); err != nil && !apierrors.IsNotFound(err) {
+					fmt.Fprintf(out, "failed to delete pod %s: %s\n", name, err)
+				}
+			}
+		}(fmt.Sprintf("%s-pod-%d", globalPrefix, i))
+	}
+	wg.Wait()
+
+	fmt.Fprintf(out, "pod creates: %s\n", createStats)
+	fmt.Fprintf(out, "bindings: %s\n", bindStats)
+}
+
+func fakeNodeName(i int) string {
+	return fmt.Sprintf("%s-fake-node-%d", commonPrefix, i%bindNodes)
+}
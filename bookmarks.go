@@ -0,0 +1,127 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"sort"
+	"strconv"
+	"sync"
+	"time"
+
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/client-go/rest"
+)
+
+// probes the staleness of bookmarks is measured against, about 10 minutes
+// of them at the default interval
+const maxBookmarkProbes = 600
+
+var (
+	// how often 'watch' reads the current resourceVersion to tell how stale
+	// bookmarks are, -bookmarkProbeInterval, 0 does not
+	bookmarkProbeInterval time.Duration
+
+	// time between two bookmarks of a watch
+	bookmarkIntervals histogram
+	// how long before its arrival the resourceVersion of a bookmark was
+	// current
+	bookmarkStaleness histogram
+
+	probesMu sync.Mutex
+	// resourceVersions read every bookmarkProbeInterval, oldest first
+	probes []rvProbe
+)
+
+// rvProbe is the resourceVersion of the store at a time.
+type rvProbe struct {
+	time time.Time
+	rv   uint64
+}
+
+// bookmarkSummary is what the bookmarks of the watches told.
+type bookmarkSummary struct {
+	Intervals latencySummary  `json:"intervals"`
+	Staleness *latencySummary `json:"staleness,omitempty"`
+}
+
+// observeBookmark records a bookmark with resourceVersion rv arriving now,
+// last being the previous bookmark of the watch, if any.
+func observeBookmark(last time.Time, rv string) {
+	now := time.Now()
+	if !last.IsZero() {
+		bookmarkIntervals.observe(now.Sub(last))
+	}
+	if bookmarkProbeInterval == 0 {
+		return
+	}
+	// resourceVersions are opaque to clients, but etcd revisions in practice
+	n, err := strconv.ParseUint(rv, 10, 64)
+	if err != nil {
+		return
+	}
+	probesMu.Lock()
+	defer probesMu.Unlock()
+	i := sort.Search(len(probes), func(i int) bool { return probes[i].rv >= n })
+	switch {
+	case len(probes) == 0, i == 0:
+		// older than every probe, how much is unknown
+	case i == len(probes):
+		// newer than the last probe
+		bookmarkStaleness.observe(0)
+	default:
+		// the store reached rv between probes i-1 and i
+		bookmarkStaleness.observe(now.Sub(probes[i].time))
+	}
+}
+
+// probeResourceVersions reads the resourceVersion of the store with a quorum
+// list of one object every bookmarkProbeInterval until ctx is done. The
+// probes are not recorded, they are not part of the load.
+func probeResourceVersions(ctx context.Context, config *rest.Config, resourceType string) {
+	client := metadataClient(config)
+	gvr := cleanResource(resourceType)
+	for {
+		list, err := client.Resource(gvr).Namespace(namespaceAt(0)).List(ctx, metav1.ListOptions{Limit: 1, TimeoutSeconds: &timeout})
+		if err == nil {
+			if n, err := strconv.ParseUint(list.ResourceVersion, 10, 64); err == nil {
+				probesMu.Lock()
+				probes = append(probes, rvProbe{time: time.Now(), rv: n})
+				if len(probes) > maxBookmarkProbes {
+					probes = probes[len(probes)-maxBookmarkProbes:]
+				}
+				probesMu.Unlock()
+			}
+		}
+		select {
+		case <-ctx.Done():
+			return
+		case <-time.After(bookmarkProbeInterval):
+		}
+	}
+}
+
+func bookmarkSummaries() *bookmarkSummary {
+	bookmarkIntervals.mu.Lock()
+	count := bookmarkIntervals.count
+	bookmarkIntervals.mu.Unlock()
+	if count == 0 {
+		return nil
+	}
+	s := &bookmarkSummary{Intervals: bookmarkIntervals.summary()}
+	if bookmarkProbeInterval > 0 {
+		staleness := bookmarkStaleness.summary()
+		s.Staleness = &staleness
+	}
+	return s
+}
+
+func printBookmarks(w io.Writer) {
+	if bookmarkSummaries() == nil {
+		return
+	}
+	fmt.Fprintf(w, "bookmark intervals: %s\n", &bookmarkIntervals)
+	if bookmarkProbeInterval > 0 {
+		fmt.Fprintf(w, "bookmark staleness: %s\n", &bookmarkStaleness)
+	}
+}
@@ -0,0 +1,91 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"sort"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+// how often 'create' rewrites the -checkpoint file
+const checkpointInterval = 10 * time.Second
+
+// -checkpoint file, none if empty
+var checkpointFile string
+
+var (
+	checkpointMu sync.Mutex
+	// names of the objects of the run known to exist
+	createdNames []string
+)
+
+// checkpoint is the progress of a 'create' run as of Time. Created lists
+// the objects of the run that exist, those of a resumed run included, so
+// they can be cleaned up or verified even if cpburner dies.
+type checkpoint struct {
+	SchemaVersion int       `json:"schemaVersion"`
+	Time          time.Time `json:"time"`
+	RunPrefix     string    `json:"runPrefix"`
+	ResourceType  string    `json:"resourceType"`
+	Done          bool      `json:"done"`
+	Success       int64     `json:"success"`
+	Failure       int64     `json:"failure"`
+	Created       []string  `json:"created"`
+}
+
+func recordCreated(name string) {
+	if checkpointFile == "" {
+		return
+	}
+	checkpointMu.Lock()
+	createdNames = append(createdNames, name)
+	checkpointMu.Unlock()
+}
+
+// checkpointPeriodically writes the checkpoint every checkpointInterval for
+// the rest of the run, gen writes it a last time at the end. The existing
+// objects of a resumed run are in from the start.
+func checkpointPeriodically(resourceType string) {
+	checkpointMu.Lock()
+	for name := range existingNames {
+		createdNames = append(createdNames, name)
+	}
+	checkpointMu.Unlock()
+	for {
+		writeCheckpoint(resourceType, false)
+		time.Sleep(checkpointInterval)
+	}
+}
+
+// writeCheckpoint replaces the checkpoint file through a rename, so a crash
+// while writing leaves the previous one intact.
+func writeCheckpoint(resourceType string, done bool) {
+	checkpointMu.Lock()
+	names := append([]string{}, createdNames...)
+	checkpointMu.Unlock()
+	sort.Strings(names)
+	data, err := json.Marshal(checkpoint{
+		SchemaVersion: schemaVersion,
+		Time:          time.Now(),
+		RunPrefix:     globalPrefix,
+		ResourceType:  resourceType,
+		Done:          done,
+		Success:       atomic.LoadInt64(&counterSuccess),
+		Failure:       atomic.LoadInt64(&counterFailure),
+		Created:       names,
+	})
+	if err != nil {
+		panic(err)
+	}
+	tmp := checkpointFile + ".tmp"
+	if err := os.WriteFile(tmp, data, 0644); err != nil {
+		fmt.Fprintf(out, "failed to write checkpoint: %s\n", err)
+		return
+	}
+	if err := os.Rename(tmp, checkpointFile); err != nil {
+		fmt.Fprintf(out, "failed to write checkpoint: %s\n", err)
+	}
+}
@@ -0,0 +1,248 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"sync/atomic"
+	"time"
+
+	"cpburner/pkg/burner"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/util/wait"
+	"k8s.io/client-go/kubernetes"
+	"k8s.io/client-go/rest"
+)
+
+const (
+	// how often 'clean' prints its progress
+	cleanProgressInterval = 10 * time.Second
+	// rounds of DeleteCollection calls in a row that leave as many objects
+	// as before, after which deleteCollection gives up
+	deleteCollectionStalls = 5
+)
+
+// wait between rounds of DeleteCollection calls, doubling while they delete
+// nothing
+var deleteCollectionBackoff = wait.Backoff{Duration: time.Second, Factor: 2, Steps: deleteCollectionStalls, Cap: 30 * time.Second}
+
+var (
+	// objects 'clean' found to delete, -1 until counted, deleted so far and
+	// left terminating, e.g. held by a finalizer
+	cleanTotal       int64 = -1
+	cleanDeleted     int64
+	cleanTerminating int64
+)
+
+const (
+	cleanStrategyDelete           = "delete"
+	cleanStrategyDeleteCollection = "deletecollection"
+	cleanStrategyNamespace        = "namespace"
+)
+
+func recordDeleted(string) {
+	atomic.AddInt64(&cleanDeleted, 1)
+}
+
+func recordTerminating(string) {
+	atomic.AddInt64(&cleanTerminating, 1)
+}
+
+// printCleanProgress prints how many objects clean deleted and has left, at
+// what rate and when it should be done at that rate, every
+// cleanProgressInterval until done is closed.
+func printCleanProgress(start time.Time, done chan struct{}) {
+	ticker := time.NewTicker(cleanProgressInterval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-done:
+			return
+		case <-ticker.C:
+		}
+		deleted, total := atomic.LoadInt64(&cleanDeleted), atomic.LoadInt64(&cleanTotal)
+		rate := float64(deleted) / time.Since(start).Seconds()
+		if total < 0 {
+			fmt.Fprintf(out, "clean: deleted %d, %.1f objects/s, still counting what is left\n", deleted, rate)
+			continue
+		}
+		left := total - deleted
+		if left < 0 {
+			// objects created meanwhile were deleted too
+			left = 0
+		}
+		eta := "unknown"
+		if rate > 0 {
+			eta = (time.Duration(float64(left)/rate) * time.Second).Round(time.Second).String()
+		}
+		fmt.Fprintf(out, "clean: deleted %d of %d, %d left, %.1f objects/s, ETA %s\n", deleted, total, left, rate, eta)
+	}
+}
+
+// deleteCollection removes all matching objects with DeleteCollection calls,
+// repeating the call until only terminating objects are left since the
+// server may not finish a large collection within the request timeout.
+// Transient failures are retried with the next call, backing off between
+// rounds that delete nothing and giving up after deleteCollectionStalls of
+// them. It returns how many objects were removed.
+func deleteCollection(ctx context.Context, clientset *kubernetes.Clientset, resourceType string) (int64, error) {
+	opts := metav1.ListOptions{TimeoutSeconds: &timeout, LabelSelector: runSelector(), FieldSelector: fieldSelector}
+	before, _, err := countLiveObjects(ctx, clientset, resourceType, opts)
+	if err != nil {
+		return 0, err
+	}
+	atomic.StoreInt64(&cleanTotal, before)
+	remaining := before
+	var terminating int64
+	backoff := deleteCollectionBackoff
+	stalls := 0
+	for remaining > 0 {
+		var lastErr error
+		for _, ns := range targetNamespaces() {
+			start := time.Now()
+			err := burner.Generator(resourceType).DeleteCollection(ctx, clientset, ns, deleteOptions(), opts)
+			record(verbDeleteCollection, resourceName(resourceType), start, err)
+			if err != nil && !burner.IsTransient(err) {
+				return before - remaining, fmt.Errorf("deleting the %s of namespace %s: %w", resourceName(resourceType), ns, err)
+			}
+			if err != nil {
+				lastErr = err
+			}
+		}
+		previous := remaining
+		if remaining, terminating, err = countLiveObjects(ctx, clientset, resourceType, opts); err != nil {
+			return before - previous, err
+		}
+		atomic.StoreInt64(&cleanDeleted, before-remaining)
+		if remaining < previous {
+			stalls = 0
+			backoff = deleteCollectionBackoff
+		} else if stalls++; stalls == deleteCollectionStalls {
+			err := fmt.Errorf("%d %s left after %d rounds of DeleteCollection deleting none", remaining, resourceName(resourceType), stalls)
+			if lastErr != nil {
+				err = fmt.Errorf("%s: %w", err, lastErr)
+			}
+			return before - remaining, err
+		}
+		if remaining > 0 {
+			select {
+			case <-ctx.Done():
+				return before - remaining, ctx.Err()
+			case <-time.After(backoff.Step()):
+			}
+		}
+	}
+	atomic.StoreInt64(&cleanTerminating, terminating)
+	return before - remaining, nil
+}
+
+// previewClean prints how many objects clean would delete in every target
+// namespace, and which namespaces the 'namespace' strategy would delete,
+// without deleting anything.
+func previewClean(config *rest.Config, resourceType string) error {
+	ctx := context.Background()
+	clientset, err := kubernetes.NewForConfig(config)
+	if err != nil {
+		panic(err)
+	}
+	resource := resourceName(resourceType)
+	if templateName != "" {
+		resource = objectTemplates[templateName].gvr.Resource
+	}
+	opts := metav1.ListOptions{TimeoutSeconds: &timeout, LabelSelector: runSelector(), FieldSelector: fieldSelector}
+	var total int64
+	for _, ns := range targetNamespaces() {
+		var n int64
+		if filtersObjects() {
+			var names []string
+			names, err = deletableObjects(ctx, metadataClient(config), cleanResource(resourceType), ns)
+			n = int64(len(names))
+		} else if templateName != "" {
+			n, err = countTemplateObjectsIn(ctx, config, ns, opts)
+		} else {
+			n, err = countObjectsIn(ctx, clientset, resourceType, ns, opts)
+		}
+		if err != nil {
+			return err
+		}
+		total += n
+		if cleanStrategy == cleanStrategyNamespace {
+			fmt.Fprintf(out, "namespace %s: %d %s, the namespace would be deleted with everything in it\n", ns, n, resource)
+		} else if n > 0 {
+			fmt.Fprintf(out, "namespace %s: %d %s\n", ns, n, resource)
+		}
+	}
+	fmt.Fprintf(out, "dry run: clean strategy '%s' would delete %d %s in %d namespaces, nothing was deleted\n",
+		cleanStrategy, total, resource, len(targetNamespaces()))
+	return nil
+}
+
+// countObjects counts the matching objects in all target namespaces.
+func countObjects(ctx context.Context, clientset *kubernetes.Clientset, resourceType string, opts metav1.ListOptions) (int64, error) {
+	var count int64
+	for _, ns := range targetNamespaces() {
+		n, err := countObjectsIn(ctx, clientset, resourceType, ns, opts)
+		if err != nil {
+			return 0, err
+		}
+		count += n
+	}
+	return count, nil
+}
+
+// countLiveObjects counts the matching objects in all target namespaces,
+// apart from those terminating, and those terminating.
+func countLiveObjects(ctx context.Context, clientset *kubernetes.Clientset, resourceType string, opts metav1.ListOptions) (int64, int64, error) {
+	var live, terminating int64
+	for _, ns := range targetNamespaces() {
+		err := listObjectsIn(ctx, clientset, resourceType, ns, opts, func(meta metav1.ObjectMeta) {
+			if meta.DeletionTimestamp != nil {
+				terminating++
+			} else {
+				live++
+			}
+		})
+		if err != nil {
+			return 0, 0, err
+		}
+	}
+	return live, terminating, nil
+}
+
+// countObjectsIn pages through the objects of ns, retrying pages that fail
+// transiently.
+func countObjectsIn(ctx context.Context, clientset *kubernetes.Clientset, resourceType string, ns string, opts metav1.ListOptions) (int64, error) {
+	var count int64
+	err := listObjectsIn(ctx, clientset, resourceType, ns, opts, func(metav1.ObjectMeta) { count++ })
+	if err != nil {
+		return 0, err
+	}
+	return count, nil
+}
+
+// listObjectsIn pages through the objects of ns and calls f with the
+// metadata of every one, retrying pages that fail transiently.
+func listObjectsIn(ctx context.Context, clientset *kubernetes.Clientset, resourceType string, ns string, opts metav1.ListOptions, f func(meta metav1.ObjectMeta)) error {
+	if opts.Limit == 0 {
+		opts.Limit = listLimit
+	}
+	for {
+		var metas []metav1.ObjectMeta
+		var listMeta metav1.ListMeta
+		err := burner.Retry(ctx, func() (err error) {
+			start := time.Now()
+			metas, listMeta, err = burner.Generator(resourceType).List(ctx, clientset, ns, opts)
+			record(verbList, resourceName(resourceType), start, err)
+			return err
+		})
+		if err != nil {
+			return fmt.Errorf("listing the %s of namespace %s: %w", resourceName(resourceType), ns, err)
+		}
+		for _, meta := range metas {
+			f(meta)
+		}
+		if listMeta.Continue == "" {
+			return nil
+		}
+		opts.Continue = listMeta.Continue
+	}
+}
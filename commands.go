@@ -0,0 +1,205 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"os"
+	"strings"
+
+	"github.com/spf13/cobra"
+	"github.com/spf13/pflag"
+)
+
+const actionReport = "report"
+
+// command runs an action as 'cpburner <name> [flags]'. It accepts the flags
+// every command shares and its own flags, but not those of other commands.
+type command struct {
+	name    string
+	summary string
+	flags   []string
+}
+
+var commands = []command{
+	{actionCreate, "Create -resourceCount objects, or objects of a bundled -template", []string{"resourceCount", "template", "resumePrefix", "clientsets", "checkpoint"}},
+	{actionApply, "Server-side apply -resourceCount objects from -fieldManagers field managers", []string{"resourceCount", "fieldManagers"}},
+	{actionList, "Page through all objects", []string{"listForever", "listMethod", "listDecode", "maxListResponseBytes", "listResourceVersion", "listResourceVersionMatch", "labelSelector"}},
+	{actionGet, "Get objects by name -resourceCount times", []string{"resourceCount"}},
+	{actionVerify, "Compare the objects of a create run with the names it should have made", []string{"resourceCount", "verifyPrefix"}},
+	{actionMix, "Issue -resourceCount requests with the -mix of verbs", []string{"resourceCount", "mix"}},
+	{actionPipeline, "Take -resourceCount objects through the -pipeline of verbs", []string{"resourceCount", "pipeline", "pipelineThinkTime"}},
+	{actionStatus, "Patch the status of -statusObjects pods -resourceCount times", []string{"resourceCount", "statusObjects"}},
+	{actionBind, "Bind -resourceCount pods to -bindNodes fake nodes", []string{"resourceCount", "bindNodes"}},
+	{actionAdmission, "Break down create latency by admission webhooks", []string{"resourceCount", "webhookURL", "webhookService", "webhookPath", "webhookCAFile"}},
+	{actionConflict, "Update -conflictObjects objects from every worker, retrying on conflicts", []string{"resourceCount", "conflictObjects", "conflictRetries"}},
+	{actionWatch, "Keep -watchers watches open and count the events of every one", []string{"watchers", "watchResourceVersion", "watchLabelSelectors", "bookmarkProbeInterval", "labelSelector", "fieldSelector"}},
+	{actionInformers, "Run -informers shared informers on the objects like a fleet of controllers, reporting their sync times and memory", []string{"informers", "informerResync", "labelSelector", "fieldSelector"}},
+	{actionWatchStorm, "Drop all watches at once, as a failover would, and measure their relists", []string{"storms", "stormInterval", "stormAddr"}},
+	{actionRelist, "Have every worker list all objects at once, unpaginated, as controllers restarting after an apiserver rollout do", []string{"storms", "stormInterval", "listDecode", "maxListResponseBytes", "listResourceVersion", "listResourceVersionMatch", "labelSelector"}},
+	{actionWatchSweep, "Measure how often watches are re-established across watcher counts and timeouts", []string{"watchResourceVersion", "labelSelector", "fieldSelector", "sweepWatchers", "sweepTimeouts", "sweepDuration"}},
+	{actionConsistency, "Compare the item counts several apiservers serve", []string{"apiservers", "consistencyInterval", "consistencyResourceVersion"}},
+	{actionTuneListLimit, "Find the list page size that lists fastest", []string{"tuneRounds"}},
+	{actionFinalize, "Remove the cpburner/block finalizer of -finalizer from the objects of the run, at the paced rate", []string{"labelSelector", "fieldSelector", "template"}},
+	{actionClean, "Delete the objects cpburner created", []string{"labelSelector", "fieldSelector", "cleanStrategy", "template", "allRuns", "allNamespaces", "expired", "olderThan"}},
+	{actionOrphans, "Count the objects every run left behind, with their size and age, e.g. to find those of crashed runs", []string{"labelSelector", "fieldSelector", "template", "allNamespaces"}},
+	{actionReport, "Print the run reports stored in -resultsNamespace", nil},
+	{actionOperator, "Run the CpBurnerRun custom resources of -operatorNamespace one by one, reporting progress and results in their status", []string{"operatorNamespace"}},
+	{actionManifest, "Print a Job or Deployment running -manifestCommand with the other flags in-cluster, with its ServiceAccount and RBAC", manifestFlags},
+}
+
+// createsObjects tells whether the action creates objects named after the
+// run prefix.
+func createsObjects(action string) bool {
+	switch action {
+	case actionCreate, actionApply, actionMix, actionPipeline, actionStatus, actionBind, actionAdmission, actionConflict:
+		return true
+	}
+	return false
+}
+
+func lookupCommand(name string) *command {
+	for i := range commands {
+		if commands[i].name == name {
+			return &commands[i]
+		}
+	}
+	return nil
+}
+
+// accepts tells whether the flag name is shared or one of c's own. manifest
+// accepts the flags of every command, printManifest checks them against
+// -manifestCommand.
+func (c *command) accepts(name string) bool {
+	if name == "action" {
+		return false
+	}
+	if c.name == actionManifest {
+		return true
+	}
+	owned := false
+	for _, cmd := range commands {
+		for _, f := range cmd.flags {
+			if f == name {
+				if cmd.name == c.name {
+					return true
+				}
+				owned = true
+			}
+		}
+	}
+	return !owned
+}
+
+// rootCommand is the command line, 'cpburner' with a subcommand per command.
+var rootCommand *cobra.Command
+
+// parseCommandLine parses 'cpburner <command> [flags]', or the flags alone
+// with the command given by -action. The flags stay go flags cobra parses
+// into the same variables, and it takes -name for --name so they keep their
+// single dash.
+func parseCommandLine() {
+	ran := false
+	rootCommand = &cobra.Command{
+		Use:   "cpburner",
+		Short: "Load the Kubernetes control plane",
+		Long: fmt.Sprintf("cpburner loads the Kubernetes control plane with the requests of a command.\n"+
+			"Every flag can also be set through the environment, e.g. -targetQPS through %s.", envName("targetQPS")),
+		Args: cobra.NoArgs,
+		Run: func(c *cobra.Command, args []string) {
+			ran = true
+			setGoFlags(c)
+		},
+	}
+	flag.VisitAll(func(f *flag.Flag) {
+		if sharedFlag(f.Name) {
+			rootCommand.PersistentFlags().AddGoFlag(f)
+		} else {
+			rootCommand.Flags().AddGoFlag(f)
+		}
+	})
+	for i := range commands {
+		cmd := &commands[i]
+		sub := &cobra.Command{
+			Use:   cmd.name + " [flags]",
+			Short: cmd.summary,
+			Args:  cobra.NoArgs,
+			Run: func(c *cobra.Command, args []string) {
+				ran = true
+				setGoFlags(c)
+				// set like the flag, so a -config scenario does not override it
+				flag.Set("action", cmd.name)
+			},
+		}
+		flag.VisitAll(func(f *flag.Flag) {
+			if !sharedFlag(f.Name) && cmd.accepts(f.Name) {
+				sub.Flags().AddGoFlag(f)
+			}
+		})
+		rootCommand.AddCommand(sub)
+	}
+	rootCommand.SetArgs(doubleDash(os.Args[1:]))
+	if err := rootCommand.Execute(); err != nil {
+		os.Exit(2)
+	}
+	if !ran {
+		// printed the help or a completion script
+		os.Exit(0)
+	}
+}
+
+// sharedFlag tells whether every command accepts the flag name.
+func sharedFlag(name string) bool {
+	return (&command{}).accepts(name)
+}
+
+// setGoFlags marks the flags cobra parsed as set on the go command line too,
+// where the environment, -config and the coordinator look for them.
+func setGoFlags(c *cobra.Command) {
+	c.Flags().Visit(func(f *pflag.Flag) {
+		flag.Set(f.Name, f.Value.String())
+	})
+}
+
+// doubleDash turns the -name flags of args into the --name cobra parses,
+// leaving flag values alone.
+func doubleDash(args []string) []string {
+	out := make([]string, 0, len(args))
+	for i := 0; i < len(args); i++ {
+		a := args[i]
+		if a == "--" {
+			return append(out, args[i:]...)
+		}
+		name, _, hasValue := strings.Cut(strings.TrimLeft(a, "-"), "=")
+		f := flag.Lookup(name)
+		if !strings.HasPrefix(a, "-") || f == nil && name != "help" {
+			out = append(out, a)
+			continue
+		}
+		out = append(out, "--"+strings.TrimLeft(a, "-"))
+		if f != nil && !hasValue && !isBoolFlag(f) && i+1 < len(args) {
+			i++
+			out = append(out, args[i])
+		}
+	}
+	return out
+}
+
+func isBoolFlag(f *flag.Flag) bool {
+	b, ok := f.Value.(interface{ IsBoolFlag() bool })
+	return ok && b.IsBoolFlag()
+}
+
+// usageError prints what is wrong with the flags along with the usage of the
+// command they were given to, and exits.
+func usageError(format string, a ...interface{}) {
+	c := rootCommand
+	for _, sub := range rootCommand.Commands() {
+		if sub.Name() == flag.Lookup("action").Value.String() {
+			c = sub
+		}
+	}
+	fmt.Fprintf(c.ErrOrStderr(), "error: "+format+"\n\n", a...)
+	c.Usage()
+	sendFinalStats(false)
+	os.Exit(2)
+}
@@ -0,0 +1,86 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"math/rand"
+	"sync"
+	"sync/atomic"
+
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	"k8s.io/client-go/kubernetes"
+	"k8s.io/client-go/rest"
+)
+
+// conflictStorm creates conflictObjects objects and has concurrency workers
+// perform resourceCount read-modify-write updates in total against them, so
+// most updates hit 409 Conflicts. A conflicting update is retried up to
+// conflictRetries times, and the report shows how many attempts updates
+// needed.
+func conflictStorm(config *rest.Config, resourceCount int, resourceType string) {
+	ctx := context.Background()
+	clientset, err := kubernetes.NewForConfig(config)
+	if err != nil {
+		panic(err)
+	}
+	setup := &objectClient{clientset: clientset, resourceType: resourceType}
+	names := []string{}
+	for i := 0; i < conflictObjects; i++ {
+		name := objectName(globalPrefix+"-conflict", i)
+		if err := setup.create(ctx, name); err != nil {
+			panic(err)
+		}
+		names = append(names, name)
+	}
+	defer func() {
+		for _, name := range names {
+			if err := setup.delete(ctx, name); err != nil {
+				fmt.Fprintf(out, "failed to delete %s %s: %s\n", resourceType, name, err)
+			}
+		}
+	}()
+
+	// attempts[i] counts updates that succeeded on attempt i+1
+	attempts := make([]int64, conflictRetries+1)
+	var conflicts, exhausted, otherErrors int64
+	wg := sync.WaitGroup{}
+	count := int(resourceCount / concurrency)
+	for i := 0; i < concurrency; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			clientset, err := kubernetes.NewForConfig(workerConfig(config))
+			if err != nil {
+				panic(err)
+			}
+			c := &objectClient{clientset: clientset, resourceType: resourceType}
+			for j := 0; keepGoing(j, count); j++ {
+				name := names[rand.Intn(len(names))]
+				for attempt := 0; ; attempt++ {
+					err := c.touch(ctx, name)
+					if err == nil {
+						atomic.AddInt64(&attempts[attempt], 1)
+						break
+					}
+					if !apierrors.IsConflict(err) {
+						atomic.AddInt64(&otherErrors, 1)
+						break
+					}
+					atomic.AddInt64(&conflicts, 1)
+					if attempt == conflictRetries {
+						atomic.AddInt64(&exhausted, 1)
+						break
+					}
+				}
+			}
+		}()
+	}
+	wg.Wait()
+
+	fmt.Fprintf(out, "conflicts: %d, updates given up after %d retries: %d, other errors: %d\n", conflicts, conflictRetries, exhausted, otherErrors)
+	for i, n := range attempts {
+		if n > 0 {
+			fmt.Fprintf(out, "  updates succeeding on attempt %d: %d\n", i+1, n)
+		}
+	}
+}
@@ -0,0 +1,164 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"net"
+	"net/url"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"cpburner/pkg/burner"
+	apiv1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/client-go/kubernetes"
+	"k8s.io/client-go/rest"
+)
+
+type apiserverView struct {
+	host            string
+	count           int64
+	resourceVersion string
+	err             error
+}
+
+// checkConsistency lists the collection through every apiserver instance once
+// per consistencyInterval and reports rounds in which they disagree on the
+// item count, plus how long each divergence window lasted.
+func checkConsistency(config *rest.Config, resourceType string) {
+	ctx := context.Background()
+	hosts := apiserverHosts(ctx, config)
+	fmt.Fprintf(out, "checking %s consistency across %d apiservers: %s\n", resourceType, len(hosts), strings.Join(hosts, ", "))
+	clientsets := make([]*kubernetes.Clientset, len(hosts))
+	for i, host := range hosts {
+		clientset, err := kubernetes.NewForConfig(apiserverConfig(config, host))
+		if err != nil {
+			panic(err)
+		}
+		clientsets[i] = clientset
+	}
+
+	var divergedSince time.Time
+	divergedRounds := 0
+	for {
+		views := make([]apiserverView, len(hosts))
+		wg := sync.WaitGroup{}
+		for i := range hosts {
+			wg.Add(1)
+			go func(i int) {
+				defer wg.Done()
+				views[i] = apiserverView{host: hosts[i]}
+				views[i].count, views[i].resourceVersion, views[i].err = countWithResourceVersion(ctx, clientsets[i], resourceType)
+			}(i)
+		}
+		wg.Wait()
+
+		if diverged(views) {
+			if divergedSince.IsZero() {
+				divergedSince = time.Now()
+			}
+			divergedRounds++
+			fmt.Fprintf(out, "DIVERGENCE at %s:\n", time.Now().Format(time.RFC3339))
+			for _, v := range views {
+				if v.err != nil {
+					fmt.Fprintf(out, "  %s: error: %s\n", v.host, v.err)
+				} else {
+					fmt.Fprintf(out, "  %s: %d items, resourceVersion %s\n", v.host, v.count, v.resourceVersion)
+				}
+			}
+		} else if !divergedSince.IsZero() {
+			fmt.Fprintf(out, "apiservers converged again after %s (%d divergent rounds)\n", time.Since(divergedSince), divergedRounds)
+			divergedSince = time.Time{}
+			divergedRounds = 0
+		}
+		time.Sleep(consistencyInterval)
+	}
+}
+
+func diverged(views []apiserverView) bool {
+	for _, v := range views {
+		if v.err == nil && views[0].err == nil && v.count != views[0].count {
+			return true
+		}
+	}
+	return false
+}
+
+// apiserverHosts returns the -apiservers flag if set, and otherwise the
+// addresses behind the default/kubernetes endpoints.
+func apiserverHosts(ctx context.Context, config *rest.Config) []string {
+	if apiservers != "" {
+		return strings.Split(apiservers, ",")
+	}
+	clientset, err := kubernetes.NewForConfig(config)
+	if err != nil {
+		panic(err)
+	}
+	endpoints, err := clientset.CoreV1().Endpoints(apiv1.NamespaceDefault).Get(ctx, "kubernetes", metav1.GetOptions{})
+	if err != nil {
+		panic(err)
+	}
+	hosts := []string{}
+	for _, subset := range endpoints.Subsets {
+		for _, port := range subset.Ports {
+			for _, addr := range subset.Addresses {
+				hosts = append(hosts, "https://"+net.JoinHostPort(addr.IP, strconv.Itoa(int(port.Port))))
+			}
+		}
+	}
+	return hosts
+}
+
+// apiserverConfig points config at a single apiserver instance while still
+// verifying its certificate against the name the cluster is normally reached by.
+func apiserverConfig(config *rest.Config, host string) *rest.Config {
+	c := rest.CopyConfig(config)
+	c.Host = host
+	if c.TLSClientConfig.ServerName == "" {
+		if u, err := url.Parse(config.Host); err == nil {
+			c.TLSClientConfig.ServerName = u.Hostname()
+		}
+	}
+	return c
+}
+
+// countWithResourceVersion counts the objects in all target namespaces and
+// returns the resourceVersion of the last list.
+func countWithResourceVersion(ctx context.Context, clientset *kubernetes.Clientset, resourceType string) (int64, string, error) {
+	var total int64
+	rv := ""
+	for _, ns := range targetNamespaces() {
+		count, nsRV, err := countInNamespace(ctx, clientset, resourceType, ns)
+		if err != nil {
+			return 0, "", err
+		}
+		total += count
+		rv = nsRV
+	}
+	return total, rv, nil
+}
+
+func countInNamespace(ctx context.Context, clientset *kubernetes.Clientset, resourceType string, ns string) (int64, string, error) {
+	var count int64
+	rv := ""
+	opts := metav1.ListOptions{TimeoutSeconds: &timeout, Limit: listLimit, ResourceVersion: consistencyResourceVersion}
+	for {
+		start := time.Now()
+		metas, listMeta, err := burner.Generator(resourceType).List(ctx, clientset, ns, opts)
+		record(verbList, resourceName(resourceType), start, err)
+		if err != nil {
+			return 0, "", err
+		}
+		count += int64(len(metas))
+		if rv == "" {
+			rv = listMeta.ResourceVersion
+		}
+		if listMeta.Continue == "" {
+			return count, rv, nil
+		}
+		opts.Continue = listMeta.Continue
+		opts.ResourceVersion = ""
+	}
+}
@@ -0,0 +1,176 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"strings"
+	"sync/atomic"
+	"time"
+)
+
+// The control APIs start, stop and adjust a run while it runs.
+
+var (
+	// whether the run waits for a start request, -waitForStart
+	waitForStart bool
+	startRequest = make(chan struct{})
+	startOnce    int32
+	stopped      int32
+	// the pacer of a -targetQPS run, nil for unpaced runs
+	activePacer *pacer
+	// listen address of the HTTP control API, -controlAddr
+	controlAddr string
+	// workers started for SetConcurrency to add up to, -maxConcurrency
+	maxConcurrency int
+)
+
+// requestStart lets a -waitForStart run start, it returns whether it was
+// waiting.
+func requestStart() bool {
+	if !atomic.CompareAndSwapInt32(&startOnce, 0, 1) {
+		return false
+	}
+	close(startRequest)
+	return true
+}
+
+// requestStop makes the worker loops issue no further requests, the run
+// then ends as it would at its deadline.
+func requestStop() {
+	if atomic.CompareAndSwapInt32(&stopped, 0, 1) {
+		fmt.Fprintln(out, "stop requested")
+	}
+}
+
+func stopRequested() bool {
+	return atomic.LoadInt32(&stopped) == 1
+}
+
+// setTargetQPS changes -targetQPS of a running paced run.
+func setTargetQPS(qps float64) error {
+	if qps <= 0 {
+		return fmt.Errorf("targetQPS must be positive")
+	}
+	if activePacer == nil {
+		return fmt.Errorf("the run is not paced, it needs to be started with -targetQPS")
+	}
+	if len(steps) > 0 {
+		return fmt.Errorf("the run follows -steps")
+	}
+	activePacer.setTarget(qps)
+	fmt.Fprintf(out, "targetQPS set to %g\n", qps)
+	return nil
+}
+
+// setConcurrency changes how many workers of a -maxConcurrency run issue
+// requests.
+func setConcurrency(n int) error {
+	if gate == nil {
+		return fmt.Errorf("the run needs to be started with -maxConcurrency")
+	}
+	if n < 1 || n > maxConcurrency {
+		return fmt.Errorf("concurrency must be between 1 and -maxConcurrency %d", maxConcurrency)
+	}
+	gate.setLimit(n)
+	fmt.Fprintf(out, "concurrency set to %d\n", n)
+	return nil
+}
+
+// controlStatus is what the control APIs report about the run.
+type controlStatus struct {
+	statusRecord
+	Started     bool    `json:"started"`
+	Stopped     bool    `json:"stopped"`
+	TargetQPS   float64 `json:"targetQPS"`
+	Concurrency int     `json:"concurrency"`
+}
+
+func currentControlStatus() controlStatus {
+	s := controlStatus{
+		statusRecord: statusRecord{
+			SchemaVersion: schemaVersion,
+			Time:          time.Now(),
+			Success:       atomic.LoadInt64(&counterSuccess),
+			Failure:       atomic.LoadInt64(&counterFailure),
+			Oversized:     atomic.LoadInt64(&counterOversized),
+			WatchEvents:   atomic.LoadInt64(&counterWatchEvents),
+		},
+		Started: !waitForStart || atomic.LoadInt32(&startOnce) == 1,
+		Stopped: stopRequested(),
+	}
+	if s.Started && !report.StartTime.IsZero() {
+		s.Elapsed = time.Since(report.StartTime).Seconds()
+	}
+	if activePacer != nil {
+		s.TargetQPS = float64(activePacer.QPS())
+	}
+	s.Concurrency = concurrency
+	if gate != nil {
+		s.Concurrency = gate.currentLimit()
+	}
+	return s
+}
+
+// controlConfig is what /config of the HTTP control API reads and changes.
+type controlConfig struct {
+	TargetQPS float64 `json:"targetQPS"`
+}
+
+// serveControl serves the HTTP control API on controlAddr for the rest of
+// the run: POST /start, POST /stop, GET /status, and GET or POST /config.
+func serveControl() {
+	mux := http.NewServeMux()
+	mux.HandleFunc("/start", func(w http.ResponseWriter, r *http.Request) {
+		if !allowMethod(w, r, http.MethodPost) {
+			return
+		}
+		if !requestStart() {
+			http.Error(w, "the run started already", http.StatusConflict)
+		}
+	})
+	mux.HandleFunc("/stop", func(w http.ResponseWriter, r *http.Request) {
+		if allowMethod(w, r, http.MethodPost) {
+			requestStop()
+		}
+	})
+	mux.HandleFunc("/status", func(w http.ResponseWriter, r *http.Request) {
+		if allowMethod(w, r, http.MethodGet) {
+			writeJSON(w, currentControlStatus())
+		}
+	})
+	mux.HandleFunc("/config", func(w http.ResponseWriter, r *http.Request) {
+		if !allowMethod(w, r, http.MethodGet, http.MethodPost) {
+			return
+		}
+		if r.Method == http.MethodPost {
+			c := controlConfig{}
+			if err := json.NewDecoder(r.Body).Decode(&c); err != nil {
+				http.Error(w, err.Error(), http.StatusBadRequest)
+				return
+			}
+			if err := setTargetQPS(c.TargetQPS); err != nil {
+				http.Error(w, err.Error(), http.StatusConflict)
+				return
+			}
+		}
+		writeJSON(w, controlConfig{TargetQPS: currentControlStatus().TargetQPS})
+	})
+	go func() {
+		panic(http.ListenAndServe(controlAddr, mux))
+	}()
+}
+
+func allowMethod(w http.ResponseWriter, r *http.Request, methods ...string) bool {
+	if !contains(methods, r.Method) {
+		w.Header().Set("Allow", strings.Join(methods, ", "))
+		http.Error(w, r.Method+" is not allowed", http.StatusMethodNotAllowed)
+		return false
+	}
+	return true
+}
+
+func writeJSON(w http.ResponseWriter, v interface{}) {
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(v)
+}
@@ -0,0 +1,70 @@
+package main
+
+import (
+	"bytes"
+	"fmt"
+	"strings"
+	"sync/atomic"
+	"time"
+)
+
+// dashboardHistory is how many seconds the sparklines cover.
+const dashboardHistory = 60
+
+var sparkTicks = []rune("▁▂▃▄▅▆▇█")
+
+// sparkline scales values between zero and their maximum onto sparkTicks.
+func sparkline(values []float64) string {
+	max := 0.0
+	for _, v := range values {
+		if v > max {
+			max = v
+		}
+	}
+	var b strings.Builder
+	for _, v := range values {
+		k := 0
+		if max > 0 {
+			k = int(v / max * float64(len(sparkTicks)-1))
+		}
+		b.WriteRune(sparkTicks[k])
+	}
+	return b.String()
+}
+
+// runDashboard redraws the terminal every second with the request rate and
+// mean latency of the last dashboardHistory seconds, the requests in flight
+// and the cumulative failures and latency percentiles.
+func runDashboard() {
+	rates, means := []float64{}, []float64{}
+	var last window
+	last.reset()
+	ticker := time.NewTicker(time.Second)
+	defer ticker.Stop()
+	for tick := 1; ; tick++ {
+		<-ticker.C
+		s := last.advance()
+		rate, mean := s.rate(), s.mean
+		rates, means = append(rates, rate), append(means, mean.Seconds())
+		if len(rates) > dashboardHistory {
+			rates, means = rates[1:], means[1:]
+		}
+
+		var b bytes.Buffer
+		// clear the screen and move to its top left corner
+		b.WriteString("\033[H\033[2J")
+		fmt.Fprintf(&b, "cpburner %s %s, running %s\n\n", report.Action, report.ResourceType, time.Since(report.StartTime).Round(time.Second))
+		fmt.Fprintf(&b, "requests/s   %8.1f  %s\n", rate, sparkline(rates))
+		fmt.Fprintf(&b, "mean latency %8s  %s\n", round(mean), sparkline(means))
+		fmt.Fprintf(&b, "in flight    %8d\n\n", atomic.LoadInt64(&counterInflight))
+		fmt.Fprintf(&b, "success: %d, failure: %d, oversized: %d, watch events: %d\n",
+			atomic.LoadInt64(&counterSuccess), atomic.LoadInt64(&counterFailure), atomic.LoadInt64(&counterOversized), atomic.LoadInt64(&counterWatchEvents))
+		printErrorClasses(&b)
+		printLatencies(&b)
+		out.Write(b.Bytes())
+		// keep the status stream at the pace of the status line
+		if tick%10 == 0 {
+			recordStatus()
+		}
+	}
+}
@@ -0,0 +1,338 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"flag"
+	"fmt"
+	"net/http"
+	"os"
+	"sort"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+const (
+	// how long after the last worker registered the shards start, so that
+	// all of them learn the start time in time
+	coordinatorStartDelay = 5 * time.Second
+	// how often workers send their statistics to the coordinator
+	coordinatorStatsInterval = 5 * time.Second
+)
+
+// statsClient sends the statistics of a worker, a coordinator that is gone
+// must not hold up its exit
+var statsClient = &http.Client{Timeout: 10 * time.Second}
+
+// localFlags describe the machine a worker runs on rather than the run, the
+// coordinator does not hand them out.
+var localFlags = map[string]bool{
+	"kubeconfig": true, "context": true, "server": true, "token": true, "caFile": true, "insecureSkipTLSVerify": true,
+	"config": true, "coordinator": true, "coordinatorListen": true, "expectWorkers": true, "shardTimeout": true,
+	"requestLog": true, "checkpoint": true, "timeseries": true, "outputJUnit": true, "outputJSON": true, "outputStream": true,
+	"dashboard": true, "metricsAddr": true, "pprofAddr": true, "grpcAddr": true, "controlAddr": true, "waitForStart": true, "stormAddr": true, "webhookCAFile": true,
+}
+
+var (
+	// URL of the coordinator this worker takes its shard from, -coordinator
+	coordinatorURL string
+	// address the coordinator listens on, -coordinatorListen
+	coordinatorListen string
+	expectWorkers     int
+	// how long the coordinator waits to hear from a worker, -shardTimeout
+	shardTimeout time.Duration
+	// the shard of a worker, nil unless -coordinator is given
+	assignment *shardAssignment
+	// sends the last statistics of a worker once
+	finalStats sync.Once
+)
+
+// shardAssignment is what the coordinator sends a worker once all of them
+// registered.
+type shardAssignment struct {
+	Shard  int               `json:"shard"`
+	Shards int               `json:"shards"`
+	Prefix string            `json:"prefix"`
+	Seed   int64             `json:"seed"`
+	Flags  map[string]string `json:"flags"`
+}
+
+// shardStats are the totals of a worker so far.
+type shardStats struct {
+	Shard     int               `json:"shard"`
+	Success   int64             `json:"success"`
+	Failure   int64             `json:"failure"`
+	Oversized int64             `json:"oversized"`
+	Latency   histogramSnapshot `json:"latency"`
+	Done      bool              `json:"done"`
+	Failed    bool              `json:"failed"`
+}
+
+// runName labels the objects of a run: the run prefix, shared by all shards
+// of a distributed run.
+func runName() string {
+	if assignment != nil {
+		return assignment.Prefix
+	}
+	return globalPrefix
+}
+
+// joinCoordinator registers with the coordinator, waits for the other
+// workers and sets the flags of the run it hands out.
+func joinCoordinator() error {
+	resp, err := http.Post(coordinatorURL+"/register", "application/json", nil)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return fmt.Errorf("registering: %s", resp.Status)
+	}
+	a := &shardAssignment{}
+	if err := json.NewDecoder(resp.Body).Decode(a); err != nil {
+		return err
+	}
+	for name, value := range a.Flags {
+		if err := flag.Set(name, value); err != nil {
+			return fmt.Errorf("flag %s: %v", name, err)
+		}
+	}
+	assignment = a
+	fmt.Fprintf(out, "worker of shard %d of %d of run %s\n", a.Shard+1, a.Shards, a.Prefix)
+	return nil
+}
+
+// shardLoad gives a worker its share of the request count and rates.
+func shardLoad(resourceCount *int) {
+	if assignment == nil {
+		return
+	}
+	n := assignment.Shards
+	*resourceCount = shareOf(*resourceCount)
+	targetQPS /= float64(n)
+	for i := range steps {
+		steps[i].qps /= float64(n)
+	}
+	if watchers >= n {
+		watchers = shareOf(watchers)
+	}
+}
+
+// shareOf is the share of the shard of this worker in count, the first
+// count%Shards shards take one more so that the shares add up to count.
+func shareOf(count int) int {
+	share := count / assignment.Shards
+	if assignment.Shard < count%assignment.Shards {
+		share++
+	}
+	return share
+}
+
+func currentShardStats(done bool, failed bool) shardStats {
+	return shardStats{
+		Shard:     assignment.Shard,
+		Success:   atomic.LoadInt64(&counterSuccess),
+		Failure:   atomic.LoadInt64(&counterFailure),
+		Oversized: atomic.LoadInt64(&counterOversized),
+		Latency:   allLatencies.snapshot(),
+		Done:      done,
+		Failed:    failed,
+	}
+}
+
+func sendStats(done bool, failed bool) {
+	body, err := json.Marshal(currentShardStats(done, failed))
+	if err != nil {
+		panic(err)
+	}
+	resp, err := statsClient.Post(coordinatorURL+"/stats", "application/json", bytes.NewReader(body))
+	if err != nil {
+		fmt.Fprintf(out, "failed to send stats to coordinator: %s\n", err)
+		return
+	}
+	resp.Body.Close()
+}
+
+// sendFinalStats tells the coordinator that the shard of this worker is
+// done, and failed unless ok. Every way out of a worker calls it, so the
+// coordinator does not wait for a shard that ended; only the first call
+// sends.
+func sendFinalStats(ok bool) {
+	if assignment == nil {
+		return
+	}
+	finalStats.Do(func() { sendStats(true, !ok) })
+}
+
+// failShardOnPanic is deferred by main to report the shard failed when main
+// panics, the panic goes on afterwards.
+func failShardOnPanic() {
+	if r := recover(); r != nil {
+		sendFinalStats(false)
+		panic(r)
+	}
+}
+
+// sendStatsPeriodically streams the statistics of the worker to the
+// coordinator for the rest of the run, sendFinalStats sends them a last
+// time at the end.
+func sendStatsPeriodically() {
+	for {
+		time.Sleep(coordinatorStatsInterval)
+		sendStats(false, false)
+	}
+}
+
+// coordinator hands the shards of a run to expectWorkers workers and adds
+// up the statistics they send back. A shard it has not heard from for
+// shardTimeout counts as done and failed, its worker is taken for dead.
+type coordinator struct {
+	mu         sync.Mutex
+	registered int
+	ready      chan struct{}
+	flags      map[string]string
+	stats      map[int]shardStats
+	// when the coordinator last heard from every shard
+	lastSeen map[int]time.Time
+	done     chan struct{}
+	finished bool
+}
+
+// coordinate runs the coordinator until all workers are done, then exits
+// with status 1 if any of them failed.
+func coordinate() {
+	c := &coordinator{ready: make(chan struct{}), flags: map[string]string{}, stats: map[int]shardStats{}, lastSeen: map[int]time.Time{}, done: make(chan struct{})}
+	flag.Visit(func(f *flag.Flag) {
+		if !localFlags[f.Name] {
+			c.flags[f.Name] = f.Value.String()
+		}
+	})
+	mux := http.NewServeMux()
+	mux.HandleFunc("/register", c.register)
+	mux.HandleFunc("/stats", c.receiveStats)
+	go func() {
+		panic(http.ListenAndServe(coordinatorListen, mux))
+	}()
+	fmt.Fprintf(out, "coordinating run %s, waiting for %d workers on %s\n", globalPrefix, expectWorkers, coordinatorListen)
+	for {
+		select {
+		case <-c.done:
+			os.Exit(c.printStats(true))
+		case <-time.After(10 * time.Second):
+			c.expireShards()
+			c.printStats(false)
+		}
+	}
+}
+
+func (c *coordinator) register(w http.ResponseWriter, r *http.Request) {
+	c.mu.Lock()
+	if c.registered == expectWorkers {
+		c.mu.Unlock()
+		http.Error(w, "all shards are taken", http.StatusConflict)
+		return
+	}
+	shard := c.registered
+	c.registered++
+	c.lastSeen[shard] = time.Now()
+	fmt.Fprintf(out, "worker %s took shard %d\n", r.RemoteAddr, shard+1)
+	if c.registered == expectWorkers {
+		if _, ok := c.flags["startAt"]; !ok {
+			c.flags["startAt"] = time.Now().Add(coordinatorStartDelay).Format(time.RFC3339)
+		}
+		close(c.ready)
+	}
+	c.mu.Unlock()
+	select {
+	case <-c.ready:
+	case <-r.Context().Done():
+		return
+	}
+	json.NewEncoder(w).Encode(shardAssignment{Shard: shard, Shards: expectWorkers, Prefix: globalPrefix, Seed: seed, Flags: c.flags})
+}
+
+func (c *coordinator) receiveStats(w http.ResponseWriter, r *http.Request) {
+	s := shardStats{}
+	if err := json.NewDecoder(r.Body).Decode(&s); err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if prev, ok := c.stats[s.Shard]; ok && prev.Done {
+		return
+	}
+	c.stats[s.Shard] = s
+	c.lastSeen[s.Shard] = time.Now()
+	c.checkDone()
+}
+
+// expireShards fails the shards whose worker has not sent statistics for
+// shardTimeout once the run started.
+func (c *coordinator) expireShards() {
+	select {
+	case <-c.ready:
+	default:
+		return
+	}
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	for shard := 0; shard < expectWorkers; shard++ {
+		s, ok := c.stats[shard]
+		if (ok && s.Done) || time.Since(c.lastSeen[shard]) < shardTimeout {
+			continue
+		}
+		fmt.Fprintf(out, "no statistics from shard %d for %s, counting it as failed\n", shard+1, shardTimeout)
+		s.Shard, s.Done, s.Failed = shard, true, true
+		c.stats[shard] = s
+	}
+	c.checkDone()
+}
+
+// checkDone ends the run once all shards are done, c.mu must be held.
+func (c *coordinator) checkDone() {
+	done := 0
+	for _, s := range c.stats {
+		if s.Done {
+			done++
+		}
+	}
+	if done == expectWorkers && !c.finished {
+		c.finished = true
+		close(c.done)
+	}
+}
+
+// printStats prints the totals of all shards and returns the exit status
+// of the run.
+func (c *coordinator) printStats(final bool) int {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	var success, failure, oversized int64
+	latency := &histogram{}
+	failed := []int{}
+	done := 0
+	for _, s := range c.stats {
+		success, failure, oversized = success+s.Success, failure+s.Failure, oversized+s.Oversized
+		latency.add(s.Latency)
+		if s.Done {
+			done++
+		}
+		if s.Failed {
+			failed = append(failed, s.Shard+1)
+		}
+	}
+	fmt.Fprintf(out, "workers: %d of %d registered, %d done, success: %d, failure: %d, oversized: %d\n",
+		c.registered, expectWorkers, done, success, failure, oversized)
+	fmt.Fprintf(out, "  latency: %s\n", latency)
+	if !final {
+		return 0
+	}
+	if len(failed) > 0 {
+		sort.Ints(failed)
+		fmt.Fprintf(out, "shards failing their checks: %v\n", failed)
+		return 1
+	}
+	return 0
+}
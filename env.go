@@ -0,0 +1,50 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"os"
+	"strings"
+	"unicode"
+)
+
+const envPrefix = "CPBURNER_"
+
+// envName is the environment variable setting a flag, e.g.
+// CPBURNER_TARGET_QPS for -targetQPS.
+func envName(flagName string) string {
+	runes := []rune(flagName)
+	var b strings.Builder
+	b.WriteString(envPrefix)
+	for i, r := range runes {
+		// split before a word and before the last letter of an acronym
+		// followed by one, the way webhookCAFile becomes WEBHOOK_CA_FILE
+		lowerBefore := i > 0 && unicode.IsLower(runes[i-1])
+		acronymBefore := i > 1 && unicode.IsUpper(runes[i-1]) && unicode.IsUpper(runes[i-2]) && i+1 < len(runes) && unicode.IsLower(runes[i+1])
+		if unicode.IsUpper(r) && (lowerBefore || acronymBefore) {
+			b.WriteByte('_')
+		}
+		b.WriteRune(unicode.ToUpper(r))
+	}
+	return b.String()
+}
+
+// loadEnvironment sets every flag not given on the command line from its
+// environment variable, if that is set.
+func loadEnvironment() error {
+	set := map[string]bool{}
+	flag.Visit(func(f *flag.Flag) {
+		set[f.Name] = true
+	})
+	var err error
+	flag.VisitAll(func(f *flag.Flag) {
+		value, ok := os.LookupEnv(envName(f.Name))
+		if !ok || set[f.Name] || err != nil {
+			return
+		}
+		if e := flag.Set(f.Name, value); e != nil {
+			err = fmt.Errorf("%s: %w", envName(f.Name), e)
+		}
+	})
+	return err
+}
@@ -0,0 +1,25 @@
+package main
+
+import (
+	"fmt"
+
+	apiv1 "k8s.io/api/core/v1"
+)
+
+// involvedObject returns the object a generated event is about. By default
+// every event gets an object of its own; with -eventInvolvedObjects N the
+// events of the whole run are spread evenly over N shared objects, which
+// controls the fan-in seen by event compaction and involvedObject field
+// selectors.
+func involvedObject(eventName string) apiv1.ObjectReference {
+	name := eventName
+	if eventInvolvedObjects > 0 {
+		name = fmt.Sprintf("%s-pod-%d", globalPrefix, nameHash(eventName, 0)%uint64(eventInvolvedObjects))
+	}
+	return apiv1.ObjectReference{
+		Kind:       "Pod",
+		APIVersion: "v1",
+		Namespace:  namespaceOf(eventName),
+		Name:       name,
+	}
+}
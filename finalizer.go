@@ -0,0 +1,139 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"sync"
+	"time"
+
+	"cpburner/pkg/burner"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/types"
+	"k8s.io/client-go/rest"
+)
+
+const (
+	actionFinalize = "finalize"
+
+	// finalizerName blocks the deletion of objects created with
+	// -finalizer until 'finalize' removes it
+	finalizerName = "cpburner/block"
+)
+
+// add finalizerName to the generated objects, -finalizer
+var withFinalizer bool
+
+// generatedFinalizers are the finalizers of every generated object.
+func generatedFinalizers() []string {
+	if !withFinalizer {
+		return nil
+	}
+	return []string{finalizerName}
+}
+
+// blockedObject is an object holding finalizerName, with its finalizers as
+// listed.
+type blockedObject struct {
+	namespace, name string
+	finalizers      []string
+}
+
+// finalize removes finalizerName from the objects of the run holding it,
+// spread over the workers and paced like any other request. Objects deleted
+// meanwhile go away as soon as it is removed.
+func finalize(config *rest.Config, resourceType string) error {
+	ctx := context.Background()
+	gvr := cleanResource(resourceType)
+	objects, err := listBlockedObjects(ctx, config, resourceType)
+	if err != nil {
+		return err
+	}
+	fmt.Fprintf(out, "found %d %s holding finalizer %s\n", len(objects), gvr.Resource, finalizerName)
+	wg := sync.WaitGroup{}
+	for w := 0; w < concurrency; w++ {
+		mine := []blockedObject{}
+		for i := w; i < len(objects); i += concurrency {
+			mine = append(mine, objects[i])
+		}
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			client := metadataClient(workerConfig(config))
+			// a duration-based run stops early once every object is done
+			wctx, done := context.WithCancel(ctx)
+			defer done()
+			issueUntil(wctx, len(mine), func(i int) {
+				if i >= len(mine) {
+					done()
+					return
+				}
+				obj := mine[i]
+				patch, err := removeFinalizerPatch(obj.finalizers)
+				if err != nil {
+					panic(err)
+				}
+				start := time.Now()
+				pctx, cancel := writeContext(ctx)
+				_, err = client.Resource(gvr).Namespace(obj.namespace).Patch(pctx, obj.name, types.JSONPatchType, patch, metav1.PatchOptions{})
+				cancel()
+				record(verbPatch, gvr.Resource, start, err)
+			})
+		}()
+	}
+	wg.Wait()
+	return nil
+}
+
+// listBlockedObjects lists the objects of the run holding finalizerName in
+// every target namespace.
+func listBlockedObjects(ctx context.Context, config *rest.Config, resourceType string) ([]blockedObject, error) {
+	client := metadataClient(config)
+	gvr := cleanResource(resourceType)
+	objects := []blockedObject{}
+	for _, ns := range targetNamespaces() {
+		opts := metav1.ListOptions{TimeoutSeconds: &timeout, Limit: listLimit, LabelSelector: runSelector(), FieldSelector: fieldSelector}
+		for {
+			var list *metav1.PartialObjectMetadataList
+			err := burner.Retry(ctx, func() (err error) {
+				start := time.Now()
+				list, err = client.Resource(gvr).Namespace(ns).List(ctx, opts)
+				record(verbList, gvr.Resource, start, err)
+				return err
+			})
+			if err != nil {
+				return nil, fmt.Errorf("listing the %s of namespace %s: %w", gvr.Resource, ns, err)
+			}
+			for _, obj := range list.Items {
+				for _, f := range obj.Finalizers {
+					if f == finalizerName {
+						objects = append(objects, blockedObject{namespace: ns, name: obj.Name, finalizers: obj.Finalizers})
+						break
+					}
+				}
+			}
+			if list.Continue == "" {
+				break
+			}
+			opts.Continue = list.Continue
+		}
+	}
+	return objects, nil
+}
+
+// removeFinalizerPatch is a JSON patch replacing finalizers by the same
+// without finalizerName. It first tests that they did not change since they
+// were listed, so finalizers added by others meanwhile are kept: the patch
+// fails instead.
+func removeFinalizerPatch(finalizers []string) ([]byte, error) {
+	kept := []string{}
+	for _, f := range finalizers {
+		if f != finalizerName {
+			kept = append(kept, f)
+		}
+	}
+	return json.Marshal([]map[string]interface{}{
+		{"op": "test", "path": "/metadata/finalizers", "value": finalizers},
+		{"op": "replace", "path": "/metadata/finalizers", "value": kept},
+	})
+}
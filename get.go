@@ -0,0 +1,100 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"math/rand"
+	"strings"
+	"sync"
+	"time"
+
+	"cpburner/pkg/burner"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/client-go/kubernetes"
+	"k8s.io/client-go/rest"
+)
+
+// get issues resourceCount GETs in total, each against an object picked at
+// random from the ones previously created by cpburner.
+func get(config *rest.Config, resourceCount int, resourceType string) error {
+	ctx := context.Background()
+	clientset, err := kubernetes.NewForConfig(config)
+	if err != nil {
+		panic(err)
+	}
+	names, err := listGeneratedNames(ctx, clientset, resourceType)
+	if err != nil {
+		return err
+	}
+	if len(names) == 0 {
+		fmt.Fprintf(out, "no %s objects with prefix %s found, run the 'create' action first\n", resourceType, commonPrefix)
+		return nil
+	}
+	fmt.Fprintf(out, "found %d %s objects to get\n", len(names), resourceType)
+
+	wg := sync.WaitGroup{}
+	count := int(resourceCount / concurrency)
+	for i := 0; i < concurrency; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			clientset, err := kubernetes.NewForConfig(workerConfig(config))
+			if err != nil {
+				panic(err)
+			}
+			getObjects(ctx, clientset, resourceType, names, count)
+		}()
+	}
+	wg.Wait()
+	return nil
+}
+
+// isGenerated tells whether cpburner generated the object name, in the run
+// -runPrefix if set.
+func isGenerated(name string) bool {
+	if runPrefix != "" {
+		return strings.HasPrefix(name, runPrefix+"-")
+	}
+	return strings.HasPrefix(name, commonPrefix+"-")
+}
+
+// listGeneratedNames lists the names of the objects cpburner generated in
+// the target namespaces, retrying pages that fail transiently.
+func listGeneratedNames(ctx context.Context, clientset *kubernetes.Clientset, resourceType string) ([]string, error) {
+	generator := burner.Generator(resourceType)
+	names := []string{}
+	for _, ns := range targetNamespaces() {
+		continueString := ""
+		for {
+			var page []metav1.ObjectMeta
+			var listMeta metav1.ListMeta
+			err := burner.Retry(ctx, func() (err error) {
+				page, listMeta, err = generator.List(ctx, clientset, ns, metav1.ListOptions{TimeoutSeconds: &timeout, Limit: listLimit, Continue: continueString})
+				return err
+			})
+			if err != nil {
+				return nil, fmt.Errorf("listing the %s of namespace %s: %w", resourceName(resourceType), ns, err)
+			}
+			for _, meta := range page {
+				if isGenerated(meta.Name) {
+					names = append(names, meta.Name)
+				}
+			}
+			continueString = listMeta.Continue
+			if continueString == "" {
+				break
+			}
+		}
+	}
+	return names, nil
+}
+
+func getObjects(ctx context.Context, clientset *kubernetes.Clientset, resourceType string, names []string, count int) {
+	generator := burner.Generator(resourceType)
+	issue(count, func(int) {
+		name := names[rand.Intn(len(names))]
+		start := time.Now()
+		_, err := generator.Get(ctx, clientset, namespaceOf(name), name, metav1.GetOptions{})
+		record(verbGet, resourceName(resourceType), start, err)
+	})
+}
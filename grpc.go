@@ -0,0 +1,133 @@
+package main
+
+import (
+	"context"
+	"net"
+	"time"
+
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+	"google.golang.org/protobuf/types/known/emptypb"
+	"google.golang.org/protobuf/types/known/structpb"
+	"google.golang.org/protobuf/types/known/wrapperspb"
+)
+
+// controlServiceName is the gRPC service served on -grpcAddr. Its messages
+// are well-known protobuf types, so clients need no generated code:
+//
+//	rpc Start(google.protobuf.Empty) returns (google.protobuf.Empty)
+//	rpc Stop(google.protobuf.Empty) returns (google.protobuf.Empty)
+//	rpc SetTargetQPS(google.protobuf.DoubleValue) returns (google.protobuf.Empty)
+//	rpc SetConcurrency(google.protobuf.Int32Value) returns (google.protobuf.Empty)
+//	rpc Stats(google.protobuf.Empty) returns (stream google.protobuf.Struct)
+const controlServiceName = "cpburner.Control"
+
+// how often Stats streams the status of the run
+const controlStatsInterval = time.Second
+
+var grpcAddr string
+
+type controlServer struct{}
+
+func (controlServer) Start(ctx context.Context, _ *emptypb.Empty) (*emptypb.Empty, error) {
+	if !requestStart() {
+		return nil, status.Error(codes.FailedPrecondition, "the run started already")
+	}
+	return &emptypb.Empty{}, nil
+}
+
+func (controlServer) Stop(ctx context.Context, _ *emptypb.Empty) (*emptypb.Empty, error) {
+	requestStop()
+	return &emptypb.Empty{}, nil
+}
+
+func (controlServer) SetTargetQPS(ctx context.Context, qps *wrapperspb.DoubleValue) (*emptypb.Empty, error) {
+	if err := setTargetQPS(qps.GetValue()); err != nil {
+		return nil, status.Error(codes.FailedPrecondition, err.Error())
+	}
+	return &emptypb.Empty{}, nil
+}
+
+func (controlServer) SetConcurrency(ctx context.Context, n *wrapperspb.Int32Value) (*emptypb.Empty, error) {
+	if err := setConcurrency(int(n.GetValue())); err != nil {
+		return nil, status.Error(codes.FailedPrecondition, err.Error())
+	}
+	return &emptypb.Empty{}, nil
+}
+
+// Stats streams the status of the run every controlStatsInterval until the
+// client goes away.
+func (controlServer) Stats(_ *emptypb.Empty, stream grpc.ServerStream) error {
+	ticker := time.NewTicker(controlStatsInterval)
+	defer ticker.Stop()
+	for {
+		s := currentControlStatus()
+		msg, err := structpb.NewStruct(map[string]interface{}{
+			"time": s.Time.Format(time.RFC3339Nano), "elapsed": s.Elapsed, "started": s.Started, "stopped": s.Stopped, "targetQPS": s.TargetQPS, "concurrency": float64(s.Concurrency),
+			"success": float64(s.Success), "failure": float64(s.Failure), "oversized": float64(s.Oversized), "watchEvents": float64(s.WatchEvents),
+		})
+		if err != nil {
+			return status.Error(codes.Internal, err.Error())
+		}
+		if err := stream.SendMsg(msg); err != nil {
+			return err
+		}
+		select {
+		case <-stream.Context().Done():
+			return nil
+		case <-ticker.C:
+		}
+	}
+}
+
+func unaryHandler(newRequest func() interface{}, call func(ctx context.Context, req interface{}) (interface{}, error)) func(interface{}, context.Context, func(interface{}) error, grpc.UnaryServerInterceptor) (interface{}, error) {
+	return func(_ interface{}, ctx context.Context, dec func(interface{}) error, _ grpc.UnaryServerInterceptor) (interface{}, error) {
+		req := newRequest()
+		if err := dec(req); err != nil {
+			return nil, err
+		}
+		return call(ctx, req)
+	}
+}
+
+var controlServiceDesc = grpc.ServiceDesc{
+	ServiceName: controlServiceName,
+	HandlerType: (*interface{})(nil),
+	Methods: []grpc.MethodDesc{
+		{MethodName: "Start", Handler: unaryHandler(func() interface{} { return &emptypb.Empty{} }, func(ctx context.Context, req interface{}) (interface{}, error) {
+			return controlServer{}.Start(ctx, req.(*emptypb.Empty))
+		})},
+		{MethodName: "Stop", Handler: unaryHandler(func() interface{} { return &emptypb.Empty{} }, func(ctx context.Context, req interface{}) (interface{}, error) {
+			return controlServer{}.Stop(ctx, req.(*emptypb.Empty))
+		})},
+		{MethodName: "SetTargetQPS", Handler: unaryHandler(func() interface{} { return &wrapperspb.DoubleValue{} }, func(ctx context.Context, req interface{}) (interface{}, error) {
+			return controlServer{}.SetTargetQPS(ctx, req.(*wrapperspb.DoubleValue))
+		})},
+		{MethodName: "SetConcurrency", Handler: unaryHandler(func() interface{} { return &wrapperspb.Int32Value{} }, func(ctx context.Context, req interface{}) (interface{}, error) {
+			return controlServer{}.SetConcurrency(ctx, req.(*wrapperspb.Int32Value))
+		})},
+	},
+	Streams: []grpc.StreamDesc{
+		{StreamName: "Stats", ServerStreams: true, Handler: func(_ interface{}, stream grpc.ServerStream) error {
+			req := &emptypb.Empty{}
+			if err := stream.RecvMsg(req); err != nil {
+				return err
+			}
+			return controlServer{}.Stats(req, stream)
+		}},
+	},
+}
+
+// serveGRPC serves the control service on grpcAddr for the rest of the run.
+func serveGRPC() {
+	lis, err := net.Listen("tcp", grpcAddr)
+	if err != nil {
+		panic(err)
+	}
+	server := grpc.NewServer()
+	server.RegisterService(&controlServiceDesc, controlServer{})
+	go func() {
+		panic(server.Serve(lis))
+	}()
+}
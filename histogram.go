@@ -0,0 +1,200 @@
+package main
+
+import (
+	"fmt"
+	"io"
+	"math"
+	"sort"
+	"sync"
+	"time"
+)
+
+// Bucket k of a histogram holds latencies up to histogramBase*histogramGrowth^k,
+// so percentiles are accurate to within 5% from 1µs to well over an hour.
+const (
+	histogramBase    = time.Microsecond
+	histogramGrowth  = 1.05
+	histogramBuckets = 500
+)
+
+var histogramLogGrowth = math.Log(histogramGrowth)
+
+type histogram struct {
+	mu      sync.Mutex
+	buckets [histogramBuckets]int64
+	count   int64
+	sum     time.Duration
+	min     time.Duration
+	max     time.Duration
+}
+
+func (h *histogram) observe(d time.Duration) {
+	k := 0
+	if d > histogramBase {
+		k = int(math.Ceil(math.Log(float64(d)/float64(histogramBase)) / histogramLogGrowth))
+		if k >= histogramBuckets {
+			k = histogramBuckets - 1
+		}
+	}
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	h.buckets[k]++
+	if h.count == 0 || d < h.min {
+		h.min = d
+	}
+	if d > h.max {
+		h.max = d
+	}
+	h.count++
+	h.sum += d
+}
+
+// quantile returns the upper bound of the bucket holding the q-quantile,
+// capped at the largest latency seen. The caller holds h.mu.
+func (h *histogram) quantile(q float64) time.Duration {
+	rank := int64(math.Ceil(q * float64(h.count)))
+	var seen int64
+	for k, n := range h.buckets {
+		seen += n
+		if seen >= rank {
+			bound := time.Duration(float64(histogramBase) * math.Pow(histogramGrowth, float64(k)))
+			if bound > h.max {
+				bound = h.max
+			}
+			return bound
+		}
+	}
+	return h.max
+}
+
+func (h *histogram) percentile(q float64) time.Duration {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	return h.quantile(q)
+}
+
+func (h *histogram) mean() time.Duration {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	if h.count == 0 {
+		return 0
+	}
+	return h.sum / time.Duration(h.count)
+}
+
+func (h *histogram) String() string {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	if h.count == 0 {
+		return "no requests"
+	}
+	return fmt.Sprintf("count %d, min %s, mean %s, p50 %s, p90 %s, p99 %s, p999 %s, max %s",
+		h.count, round(h.min), round(h.sum/time.Duration(h.count)), round(h.quantile(0.5)), round(h.quantile(0.9)),
+		round(h.quantile(0.99)), round(h.quantile(0.999)), round(h.max))
+}
+
+func (h *histogram) summary() latencySummary {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	s := latencySummary{Count: h.count, Min: h.min.Seconds(), Max: h.max.Seconds()}
+	if h.count > 0 {
+		s.Mean = (h.sum / time.Duration(h.count)).Seconds()
+		s.P50, s.P90, s.P99, s.P999 = h.quantile(0.5).Seconds(), h.quantile(0.9).Seconds(), h.quantile(0.99).Seconds(), h.quantile(0.999).Seconds()
+	}
+	return s
+}
+
+// histogramSnapshot carries a histogram from a worker to the coordinator
+// of a distributed run.
+type histogramSnapshot struct {
+	Buckets []int64       `json:"buckets"`
+	Count   int64         `json:"count"`
+	Sum     time.Duration `json:"sum"`
+	Min     time.Duration `json:"min"`
+	Max     time.Duration `json:"max"`
+}
+
+func (h *histogram) snapshot() histogramSnapshot {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	return histogramSnapshot{Buckets: append([]int64(nil), h.buckets[:]...), Count: h.count, Sum: h.sum, Min: h.min, Max: h.max}
+}
+
+// add merges the latencies of s into h.
+func (h *histogram) add(s histogramSnapshot) {
+	if s.Count == 0 {
+		return
+	}
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	for k, n := range s.Buckets {
+		if k < histogramBuckets {
+			h.buckets[k] += n
+		}
+	}
+	if h.count == 0 || s.Min < h.min {
+		h.min = s.Min
+	}
+	if s.Max > h.max {
+		h.max = s.Max
+	}
+	h.count += s.Count
+	h.sum += s.Sum
+}
+
+func round(d time.Duration) time.Duration {
+	return d.Round(time.Microsecond)
+}
+
+var (
+	latencyMu sync.Mutex
+	// request latency histograms by verb
+	latencies = map[string]*histogram{}
+	// latency of all requests
+	allLatencies histogram
+)
+
+func observeLatency(verb string, d time.Duration) {
+	latencyMu.Lock()
+	h := latencies[verb]
+	if h == nil {
+		h = &histogram{}
+		latencies[verb] = h
+	}
+	latencyMu.Unlock()
+	h.observe(d)
+	allLatencies.observe(d)
+}
+
+func latencySummaries() map[string]latencySummary {
+	latencyMu.Lock()
+	defer latencyMu.Unlock()
+	summaries := map[string]latencySummary{}
+	for verb, h := range latencies {
+		summaries[verb] = h.summary()
+	}
+	return summaries
+}
+
+func latencySnapshots() map[string]histogramSnapshot {
+	latencyMu.Lock()
+	defer latencyMu.Unlock()
+	snapshots := map[string]histogramSnapshot{}
+	for verb, h := range latencies {
+		snapshots[verb] = h.snapshot()
+	}
+	return snapshots
+}
+
+func printLatencies(w io.Writer) {
+	latencyMu.Lock()
+	defer latencyMu.Unlock()
+	verbs := []string{}
+	for verb := range latencies {
+		verbs = append(verbs, verb)
+	}
+	sort.Strings(verbs)
+	for _, verb := range verbs {
+		fmt.Fprintf(w, "  %s latency: %s\n", verb, latencies[verb])
+	}
+}
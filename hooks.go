@@ -0,0 +1,122 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"os"
+	"os/exec"
+	"strings"
+	"time"
+)
+
+const (
+	hookPreRun  = "preRun"
+	hookPhase   = "phase"
+	hookPostRun = "postRun"
+)
+
+var (
+	// commands or webhook URLs run around the burn, -preRunHook,
+	// -phaseHook and -postRunHook
+	preRunHook  string
+	phaseHook   string
+	postRunHook string
+	hookTimeout time.Duration
+)
+
+// hookEvent is the run metadata a hook receives as JSON, on stdin for
+// commands and as the body of a POST for webhooks.
+type hookEvent struct {
+	SchemaVersion int       `json:"schemaVersion"`
+	Hook          string    `json:"hook"`
+	Time          time.Time `json:"time"`
+	RunPrefix     string    `json:"runPrefix"`
+	Action        string    `json:"action"`
+	ResourceType  string    `json:"resourceType"`
+	// the -steps step starting, counting from 1, for phase hooks
+	Phase         int     `json:"phase,omitempty"`
+	PhaseQPS      float64 `json:"phaseQPS,omitempty"`
+	PhaseDuration float64 `json:"phaseDuration,omitempty"`
+	// the outcome of the run, for post-run hooks
+	Totals *runTotals `json:"totals,omitempty"`
+	Passed *bool      `json:"passed,omitempty"`
+}
+
+func newHookEvent(hook string) hookEvent {
+	return hookEvent{SchemaVersion: schemaVersion, Hook: hook, Time: time.Now(), RunPrefix: globalPrefix, Action: report.Action, ResourceType: report.ResourceType}
+}
+
+// phaseEvent is the event of the i-th step starting.
+func phaseEvent(i int) hookEvent {
+	e := newHookEvent(hookPhase)
+	e.Phase, e.PhaseQPS, e.PhaseDuration = i+1, steps[i].qps, steps[i].duration.Seconds()
+	return e
+}
+
+func postRunEvent(passed bool) hookEvent {
+	e := newHookEvent(hookPostRun)
+	e.Totals = currentTotals()
+	e.Passed = &passed
+	return e
+}
+
+// runHook runs hook, a webhook if it is an http or https URL and a shell
+// command otherwise, within hookTimeout. Commands get the event on stdin
+// and their output goes to cpburner's.
+func runHook(hook string, e hookEvent) error {
+	if hook == "" {
+		return nil
+	}
+	data, err := json.Marshal(e)
+	if err != nil {
+		panic(err)
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), hookTimeout)
+	defer cancel()
+	if strings.HasPrefix(hook, "http://") || strings.HasPrefix(hook, "https://") {
+		req, err := http.NewRequestWithContext(ctx, http.MethodPost, hook, bytes.NewReader(data))
+		if err != nil {
+			return err
+		}
+		req.Header.Set("Content-Type", "application/json")
+		resp, err := http.DefaultClient.Do(req)
+		if err != nil {
+			return err
+		}
+		resp.Body.Close()
+		if resp.StatusCode >= 300 {
+			return fmt.Errorf("%s answered %s", hook, resp.Status)
+		}
+		return nil
+	}
+	cmd := exec.CommandContext(ctx, "sh", "-c", hook)
+	cmd.Stdin = bytes.NewReader(data)
+	cmd.Stdout, cmd.Stderr = out, out
+	cmd.Env = append(os.Environ(), "CPBURNER_HOOK="+e.Hook, "CPBURNER_RUN_PREFIX="+e.RunPrefix)
+	return cmd.Run()
+}
+
+// runPhaseHook runs -phaseHook for the i-th step in the background, so a
+// slow hook does not shift the steps after it.
+func runPhaseHook(i int) {
+	if phaseHook == "" {
+		return
+	}
+	e := phaseEvent(i)
+	go func() {
+		if err := runHook(phaseHook, e); err != nil {
+			fmt.Fprintf(out, "phase hook of step %d failed: %s\n", i+1, err)
+		}
+	}()
+}
+
+// runPostRunHook runs -postRunHook once the run is reported, however it
+// ended.
+func runPostRunHook(passed bool) {
+	if err := runHook(postRunHook, postRunEvent(passed)); err != nil {
+		fmt.Fprintf(out, "post-run hook failed: %s\n", err)
+	}
+}
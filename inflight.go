@@ -0,0 +1,53 @@
+package main
+
+import (
+	"io"
+	"net/http"
+	"sync"
+)
+
+// inflightLimiter caps the requests outstanding at once across every client
+// built from the config it wraps. Watches are long-running and would hold
+// their slot until they end, so they are not counted.
+type inflightLimiter struct {
+	slots chan struct{}
+	next  http.RoundTripper
+}
+
+func newInflightLimiter(max int) func(http.RoundTripper) http.RoundTripper {
+	slots := make(chan struct{}, max)
+	return func(next http.RoundTripper) http.RoundTripper {
+		return &inflightLimiter{slots: slots, next: next}
+	}
+}
+
+func (l *inflightLimiter) RoundTrip(req *http.Request) (*http.Response, error) {
+	if req.URL.Query().Get("watch") == "true" {
+		return l.next.RoundTrip(req)
+	}
+	select {
+	case l.slots <- struct{}{}:
+	case <-req.Context().Done():
+		return nil, req.Context().Err()
+	}
+	resp, err := l.next.RoundTrip(req)
+	if err != nil {
+		<-l.slots
+		return nil, err
+	}
+	// the request is outstanding until its body has been read
+	resp.Body = &releasingBody{ReadCloser: resp.Body, release: func() { <-l.slots }}
+	return resp, nil
+}
+
+type releasingBody struct {
+	io.ReadCloser
+	release func()
+	once    sync.Once
+}
+
+func (b *releasingBody) Close() error {
+	err := b.ReadCloser.Close()
+	b.once.Do(b.release)
+	return err
+}
@@ -0,0 +1,133 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"runtime"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"cpburner/pkg/burner"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/client-go/dynamic"
+	"k8s.io/client-go/dynamic/dynamicinformer"
+	"k8s.io/client-go/rest"
+	"k8s.io/client-go/tools/cache"
+)
+
+const actionInformers = "informers"
+
+var (
+	// informers started by 'informers', -informers, and how often they
+	// resync, -informerResync
+	informers      int
+	informerResync time.Duration
+	// informers actually started, none outside 'informers'
+	startedInformers int
+
+	// how long the informers took to sync their cache
+	informerSyncs   histogram
+	informersSynced int64
+	// events the handlers of the informers received, resyncs included
+	informerAdds, informerUpdates, informerDeletes int64
+)
+
+// informerSummary is what the informers of 'informers' went through.
+type informerSummary struct {
+	Informers int            `json:"informers"`
+	Synced    int64          `json:"synced"`
+	Sync      latencySummary `json:"sync"`
+	// heap in use once the informers synced, their caches included
+	HeapBytes uint64 `json:"heapBytes"`
+	Adds      int64  `json:"adds"`
+	Updates   int64  `json:"updates"`
+	Deletes   int64  `json:"deletes"`
+}
+
+// runInformers starts informers shared informers on the generated objects,
+// each with a clientset of its own like a fleet of controllers, and keeps
+// them running until the end of a -duration run or a stop request. Each
+// lists everything, then watches and resyncs every informerResync. It
+// reports how long they took to sync and the heap their caches take.
+func runInformers(config *rest.Config, resourceType string) {
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	gvr := burner.Generator(resourceType).Spec().GVR()
+	var before runtime.MemStats
+	runtime.ReadMemStats(&before)
+	handler := cache.ResourceEventHandlerFuncs{
+		AddFunc:    func(interface{}) { atomic.AddInt64(&informerAdds, 1) },
+		UpdateFunc: func(interface{}, interface{}) { atomic.AddInt64(&informerUpdates, 1) },
+		DeleteFunc: func(interface{}) { atomic.AddInt64(&informerDeletes, 1) },
+	}
+	wg := sync.WaitGroup{}
+	start := time.Now()
+	startedInformers = informers
+	for i := 0; i < informers; i++ {
+		client, err := dynamic.NewForConfig(workerConfig(config))
+		if err != nil {
+			panic(err)
+		}
+		factory := dynamicinformer.NewFilteredDynamicSharedInformerFactory(client, informerResync, namespaceAt(i), func(opts *metav1.ListOptions) {
+			opts.LabelSelector = selector()
+			opts.FieldSelector = fieldSelector
+		})
+		informer := factory.ForResource(gvr).Informer()
+		informer.AddEventHandler(handler)
+		factory.Start(ctx.Done())
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			if cache.WaitForCacheSync(ctx.Done(), informer.HasSynced) {
+				informerSyncs.observe(time.Since(start))
+				atomic.AddInt64(&informersSynced, 1)
+			}
+		}()
+	}
+	synced := make(chan struct{})
+	go func() {
+		wg.Wait()
+		close(synced)
+	}()
+	for {
+		select {
+		case <-synced:
+			var after runtime.MemStats
+			runtime.ReadMemStats(&after)
+			fmt.Fprintf(out, "%d informers synced in %s, heap grew by %d bytes to %d\n",
+				informers, time.Since(start).Round(time.Millisecond), int64(after.HeapAlloc)-int64(before.HeapAlloc), after.HeapAlloc)
+			synced = nil
+		case <-time.After(time.Second):
+		}
+		if (duration > 0 && !time.Now().Before(deadline)) || stopRequested() {
+			return
+		}
+	}
+}
+
+func informerSummaries() *informerSummary {
+	if startedInformers == 0 {
+		return nil
+	}
+	var mem runtime.MemStats
+	runtime.ReadMemStats(&mem)
+	return &informerSummary{
+		Informers: startedInformers,
+		Synced:    atomic.LoadInt64(&informersSynced),
+		Sync:      informerSyncs.summary(),
+		HeapBytes: mem.HeapAlloc,
+		Adds:      atomic.LoadInt64(&informerAdds),
+		Updates:   atomic.LoadInt64(&informerUpdates),
+		Deletes:   atomic.LoadInt64(&informerDeletes),
+	}
+}
+
+func printInformers() {
+	s := informerSummaries()
+	if s == nil {
+		return
+	}
+	fmt.Fprintf(out, "informers: %d of %d synced, sync time %s\n", s.Synced, s.Informers, &informerSyncs)
+	fmt.Fprintf(out, "informer events: %d adds, %d updates, %d deletes, heap %d bytes\n", s.Adds, s.Updates, s.Deletes, s.HeapBytes)
+}
@@ -0,0 +1,76 @@
+package main
+
+import (
+	"encoding/xml"
+	"fmt"
+	"os"
+	"sort"
+)
+
+// checkResult is the outcome of one check of a run, such as -maxErrors or
+// 'verify' action. Checks become the test cases of -outputJUnit.
+type checkResult struct {
+	Name    string `json:"name"`
+	Passed  bool   `json:"passed"`
+	Message string `json:"message,omitempty"`
+}
+
+func addCheck(name string, passed bool, message string) {
+	report.Checks = append(report.Checks, checkResult{Name: name, Passed: passed, Message: message})
+}
+
+type junitTestSuite struct {
+	XMLName  xml.Name        `xml:"testsuite"`
+	Name     string          `xml:"name,attr"`
+	Tests    int             `xml:"tests,attr"`
+	Failures int             `xml:"failures,attr"`
+	Time     float64         `xml:"time,attr"`
+	Cases    []junitTestCase `xml:"testcase"`
+}
+
+type junitTestCase struct {
+	Name      string        `xml:"name,attr"`
+	ClassName string        `xml:"classname,attr"`
+	Time      float64       `xml:"time,attr"`
+	Failure   *junitFailure `xml:"failure,omitempty"`
+	SystemOut string        `xml:"system-out,omitempty"`
+}
+
+type junitFailure struct {
+	Message string `xml:"message,attr"`
+}
+
+// writeJUnit renders the completed report as a test suite with a case for
+// every check and one per verb carrying its latency.
+func writeJUnit(path string) error {
+	className := "cpburner." + report.Action
+	suite := junitTestSuite{Name: "cpburner " + report.Action, Time: report.EndTime.Sub(report.StartTime).Seconds()}
+	for _, c := range report.Checks {
+		tc := junitTestCase{Name: c.Name, ClassName: className, SystemOut: c.Message}
+		if !c.Passed {
+			tc.Failure = &junitFailure{Message: c.Message}
+			suite.Failures++
+		}
+		suite.Cases = append(suite.Cases, tc)
+	}
+	verbs := []string{}
+	for verb := range report.Latencies {
+		verbs = append(verbs, verb)
+	}
+	sort.Strings(verbs)
+	for _, verb := range verbs {
+		l := report.Latencies[verb]
+		suite.Cases = append(suite.Cases, junitTestCase{
+			Name:      verb + " latency",
+			ClassName: className,
+			Time:      l.Mean,
+			SystemOut: fmt.Sprintf("count %d, p50 %gs, p90 %gs, p99 %gs, p999 %gs, max %gs", l.Count, l.P50, l.P90, l.P99, l.P999, l.Max),
+		})
+	}
+	suite.Tests = len(suite.Cases)
+	data, err := xml.MarshalIndent(suite, "", "  ")
+	if err != nil {
+		return err
+	}
+	return os.WriteFile(path, append([]byte(xml.Header), append(data, '\n')...), 0644)
+}
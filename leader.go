@@ -0,0 +1,106 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/client-go/kubernetes"
+	"k8s.io/client-go/rest"
+	"k8s.io/client-go/tools/leaderelection"
+	"k8s.io/client-go/tools/leaderelection/resourcelock"
+)
+
+const (
+	leaseDuration      = 15 * time.Second
+	leaseRenewDeadline = 10 * time.Second
+	leaseRetryPeriod   = 2 * time.Second
+	// how long waitForLeader waits for the election, a Lease a replica
+	// that died left behind expires within leaseDuration
+	leaderWaitTimeout = 2 * leaseDuration
+)
+
+var (
+	// Lease the replicas of a run elect their leader with, -leaseName,
+	// no election if empty
+	leaseName      string
+	leaseNamespace string
+
+	// identity of this replica in the election
+	leaseIdentity string
+	// identity of the current leader, unset until one is known
+	currentLeader atomic.Value
+	leaderKnown   = make(chan struct{})
+	leaderOnce    sync.Once
+)
+
+// electLeader joins the election of the replicas sharing -leaseName for the
+// rest of the run. All replicas generate load, only the leader runs the
+// phases that must run once, like cleaning up.
+func electLeader(config *rest.Config) {
+	clientset, err := kubernetes.NewForConfig(config)
+	if err != nil {
+		panic(err)
+	}
+	hostname, err := os.Hostname()
+	if err != nil {
+		panic(err)
+	}
+	leaseIdentity = hostname + "_" + globalPrefix
+	lock := &resourcelock.LeaseLock{
+		LeaseMeta:  metav1.ObjectMeta{Name: leaseName, Namespace: leaseNamespace},
+		Client:     clientset.CoordinationV1(),
+		LockConfig: resourcelock.ResourceLockConfig{Identity: leaseIdentity},
+	}
+	elector, err := leaderelection.NewLeaderElector(leaderelection.LeaderElectionConfig{
+		Lock:          lock,
+		LeaseDuration: leaseDuration,
+		RenewDeadline: leaseRenewDeadline,
+		RetryPeriod:   leaseRetryPeriod,
+		Callbacks: leaderelection.LeaderCallbacks{
+			OnStartedLeading: func(context.Context) {
+				fmt.Fprintf(out, "leading the replicas of Lease %s/%s\n", leaseNamespace, leaseName)
+			},
+			OnStoppedLeading: func() {
+				fmt.Fprintf(out, "no longer leading the replicas of Lease %s/%s\n", leaseNamespace, leaseName)
+			},
+			OnNewLeader: func(id string) {
+				currentLeader.Store(id)
+				leaderOnce.Do(func() { close(leaderKnown) })
+			},
+		},
+	})
+	if err != nil {
+		panic(err)
+	}
+	go func() {
+		// a lost lease is taken again, or by another replica
+		for {
+			elector.Run(context.Background())
+		}
+	}()
+}
+
+// waitForLeader tells whether this process runs the phases that must run
+// once, waiting up to leaderWaitTimeout for the election to settle first.
+// Without -leaseName it is always the leader.
+func waitForLeader() (bool, error) {
+	if leaseName == "" {
+		return true, nil
+	}
+	select {
+	case <-leaderKnown:
+	case <-time.After(leaderWaitTimeout):
+		return false, fmt.Errorf("no leader of Lease %s/%s after %s", leaseNamespace, leaseName, leaderWaitTimeout)
+	}
+	return leaderName() == leaseIdentity, nil
+}
+
+func leaderName() string {
+	id, _ := currentLeader.Load().(string)
+	return id
+}
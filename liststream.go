@@ -0,0 +1,163 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"time"
+
+	"cpburner/pkg/burner"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/client-go/kubernetes"
+	"k8s.io/client-go/kubernetes/scheme"
+)
+
+const (
+	listDecodeFull     = "full"
+	listDecodeStream   = "stream"
+	listDecodeMetadata = "metadata"
+
+	acceptJSON                  = "application/json"
+	acceptPartialObjectMetadata = "application/json;as=PartialObjectMetadataList;g=meta.k8s.io;v=v1"
+)
+
+var errResponseTooLarge = errors.New("list response exceeds maxListResponseBytes")
+
+// limitedReader hands out at most max bytes and fails with
+// errResponseTooLarge if the response goes on past that, so an oversized
+// response is abandoned instead of buffered.
+type limitedReader struct {
+	r   io.Reader
+	n   int64
+	max int64
+}
+
+func (l *limitedReader) Read(p []byte) (int, error) {
+	if l.max <= 0 {
+		return l.r.Read(p)
+	}
+	if l.n >= l.max {
+		n, err := l.r.Read(p[:1])
+		if n > 0 {
+			return 0, errResponseTooLarge
+		}
+		return 0, err
+	}
+	if rem := l.max - l.n; int64(len(p)) > rem {
+		p = p[:rem]
+	}
+	n, err := l.r.Read(p)
+	l.n += int64(n)
+	return n, err
+}
+
+// streamList pages through resource like the burner lists of "list" action do,
+// but decodes each response item by item so that at most one item is held in
+// memory at a time. Pages failing transiently are retried, the rest of ns
+// is skipped if they keep failing.
+func streamList(ctx context.Context, clientset *kubernetes.Clientset, ns string, resource string) error {
+	continueString := ""
+	for {
+		var next string
+		err := burner.Retry(ctx, func() (err error) {
+			start := time.Now()
+			next, err = streamListPage(ctx, clientset, ns, resource, continueString, listLimit)
+			record(verbList, resource, start, err)
+			return err
+		})
+		if err != nil && !burner.IsTransient(err) && !errors.Is(err, errResponseTooLarge) {
+			return fmt.Errorf("listing the %s of namespace %s: %w", resource, ns, err)
+		}
+		if next == "" {
+			return nil
+		}
+		continueString = next
+	}
+}
+
+func streamListPage(ctx context.Context, clientset *kubernetes.Clientset, ns string, resource string, continueString string, limit int64) (string, error) {
+	accept := acceptJSON
+	if listDecode == listDecodeMetadata {
+		accept = acceptPartialObjectMetadata
+	}
+	opts := metav1.ListOptions{TimeoutSeconds: &timeout, Limit: limit, Continue: continueString, LabelSelector: selector()}
+	if continueString == "" {
+		// the continue token carries the resourceVersion of the first page
+		opts.ResourceVersion, opts.ResourceVersionMatch = listResourceVersion, metav1.ResourceVersionMatch(listResourceVersionMatch)
+	}
+	body, err := clientset.CoreV1().RESTClient().Get().
+		Namespace(ns).
+		Resource(resource).
+		VersionedParams(&opts, scheme.ParameterCodec).
+		SetHeader("Accept", accept).
+		Stream(ctx)
+	if err != nil {
+		return "", err
+	}
+	defer body.Close()
+	return decodeListStream(&limitedReader{r: body, max: maxListResponseBytes})
+}
+
+// decodeListStream walks a JSON list response and returns its continue token.
+// The token is returned even on error, since the apiserver writes the list
+// metadata before the items and pagination can go on after an oversized page.
+func decodeListStream(r io.Reader) (string, error) {
+	dec := json.NewDecoder(r)
+	if err := expectDelim(dec, '{'); err != nil {
+		return "", err
+	}
+	continueString := ""
+	for dec.More() {
+		key, err := dec.Token()
+		if err != nil {
+			return continueString, err
+		}
+		switch key {
+		case "metadata":
+			var meta metav1.ListMeta
+			if err := dec.Decode(&meta); err != nil {
+				return continueString, err
+			}
+			continueString = meta.Continue
+		case "items":
+			tok, err := dec.Token()
+			if err != nil {
+				return continueString, err
+			}
+			if tok == nil {
+				continue
+			}
+			if delim, ok := tok.(json.Delim); !ok || delim != '[' {
+				return continueString, fmt.Errorf("unexpected token %v in list items", tok)
+			}
+			for dec.More() {
+				var item metav1.PartialObjectMetadata
+				if err := dec.Decode(&item); err != nil {
+					return continueString, err
+				}
+			}
+			if err := expectDelim(dec, ']'); err != nil {
+				return continueString, err
+			}
+		default:
+			var skip json.RawMessage
+			if err := dec.Decode(&skip); err != nil {
+				return continueString, err
+			}
+		}
+	}
+	return continueString, expectDelim(dec, '}')
+}
+
+func expectDelim(dec *json.Decoder, want json.Delim) error {
+	tok, err := dec.Token()
+	if err != nil {
+		return err
+	}
+	if delim, ok := tok.(json.Delim); !ok || delim != want {
+		return fmt.Errorf("unexpected token %v, expected %v", tok, want)
+	}
+	return nil
+}
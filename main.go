@@ -2,273 +2,1228 @@ package main
 
 import (
 	"context"
+	"errors"
 	"flag"
 	"fmt"
 	"math/rand"
+	"net/http"
 	"os"
+	"strings"
 	"sync"
 	"sync/atomic"
 	"time"
 
+	"cpburner/pkg/burner"
 	apiv1 "k8s.io/api/core/v1"
 	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/apimachinery/pkg/util/validation"
 
 	"k8s.io/client-go/kubernetes"
 	"k8s.io/client-go/rest"
 	"k8s.io/client-go/tools/clientcmd"
+	"k8s.io/client-go/util/flowcontrol"
 )
 
 const (
-	resourceTypeEvent     = "event"
-	resourceTypeConfigMap = "configmap"
+	resourceTypeConfigMap = burner.ConfigMap
 	actionCreate          = "create"
+	actionApply           = "apply"
 	actionList            = "list"
+	actionGet             = "get"
 	actionClean           = "clean"
+	actionWatch           = "watch"
+	actionWatchStorm      = "watchstorm"
+	actionWatchSweep      = "watchsweep"
+	actionConsistency     = "consistency"
+	actionMix             = "mix"
+	actionStatus          = "status"
+	actionBind            = "bind"
+	actionAdmission       = "admission"
+	actionConflict        = "conflict"
+	actionVerify          = "verify"
+	actionPipeline        = "pipeline"
+	actionTuneListLimit   = "tunelimit"
 )
 
 var (
-	timeout      int64 = 300
-	commonPrefix       = "evt"
-	globalPrefix       = fmt.Sprintf("%s-%d-%d", commonPrefix, time.Now().Unix(), rand.Intn(9999))
-	testMsg            = randomString(1024 * 24) // 24k size msg for each event or configmap
+	// timeoutSeconds of every list and watch, -listTimeoutSeconds
+	timeout int64
+	// deadline of every write, 0 means none
+	writeTimeout time.Duration
+	// every generated name starts with commonPrefix, -prefix, and those of
+	// one run with globalPrefix
+	commonPrefix string
+	globalPrefix string
+	// selects the objects of an earlier run
+	runPrefix string
+	allRuns   bool
+	// let 'clean' go through every namespace of the cluster, -allNamespaces
+	allNamespaces bool
+	// run prefix of the create run to resume, and the names it created
+	resumePrefix  string
+	existingNames map[string]bool
+	// seeds payloads and uuid names, random unless -seed is given
+	seed int64
+	// random letters the payloads of generated events and configmaps are
+	// cut from
+	testMsg string
 
 	counterSuccess int64
 	counterFailure int64
+	// list responses abandoned because they exceeded maxListResponseBytes
+	counterOversized int64
+	// events received by watches, excluding bookmarks
+	counterWatchEvents int64
+	// nanoseconds spent in all recorded requests
+	counterLatency int64
+	// requests sent during -warmup, not counted anywhere else
+	counterWarmup int64
+	// requests outstanding right now, only tracked for -metricsAddr and
+	// -dashboard
+	counterInflight int64
 
-	concurrency int
-	listLimit   int64
+	namespace string
+	// when set, objects are spread over this many namespaces named
+	// namespacePrefix and a number instead of living in namespace
+	namespaces      int
+	namespacePrefix string
+	payloadSize     int
+
+	concurrency   int
+	clientsets    int
+	listLimit     int64
+	fieldManagers int
+
+	listDecode           string
+	maxListResponseBytes int64
+	// resourceVersion semantics of the lists of 'list', -listResourceVersion
+	// and -listResourceVersionMatch
+	listResourceVersion      string
+	listResourceVersionMatch string
+
+	watchers             int
+	watchResourceVersion string
+	labelSelector        string
+	fieldSelector        string
+
+	cleanStrategy   string
+	nameStrategy    string
+	dryRun          string
+	contentType     string
+	fieldValidation string
+	// garbage collector propagation of deletes, -propagationPolicy
+	propagationPolicy string
+	templateName      string
+
+	eventInvolvedObjects int
+	statusObjects        int
+	bindNodes            int
+	conflictObjects      int
+	conflictRetries      int
+	webhookURL           string
+	webhookService       string
+	webhookPath          string
+	webhookCAFile        string
+	pipelineThinkTime    time.Duration
+	thinkTime            time.Duration
+	jitter               time.Duration
+	tuneRounds           int
+
+	apiservers                 string
+	consistencyInterval        time.Duration
+	consistencyResourceVersion string
+
+	sweepDuration time.Duration
+
+	storms        int
+	stormInterval time.Duration
+	stormAddr     string
+
+	targetQPS float64
+	openLoop  bool
+	rampUp    time.Duration
+	rampDown  time.Duration
+	// the rate oscillates by waveAmplitude*targetQPS around targetQPS
+	wavePeriod    time.Duration
+	waveAmplitude float64
+	// every burstInterval the rate rises to burstFactor*targetQPS for
+	// burstDuration
+	burstInterval time.Duration
+	burstDuration time.Duration
+	burstFactor   float64
+	maxInflight   int
+
+	// when set, workers run until deadline instead of for -resourceCount
+	// requests
+	duration time.Duration
+	deadline time.Time
+
+	warmup    time.Duration
+	warmupEnd time.Time
+
+	maxErrors    int
+	maxErrorRate float64
+	errorWindow  time.Duration
+	cleanOnAbort bool
+
+	outputStream       string
+	outputJSON         string
+	outputJUnit        string
+	perWorkerStats     bool
+	resultsNamespace   string
+	timeseriesInterval time.Duration
+	dashboard          bool
+	metricsAddr        string
+	pushgatewayURL     string
+	pushInterval       time.Duration
+	pprofAddr          string
+	tracingEndpoint    string
+	tracingSampleRate  float64
 )
 
 func main() {
-	kubeconfig := flag.String("kubeconfig", "", "Absolute path to the kubeconfig file")
-	resourceType := flag.String("resourceType", resourceTypeConfigMap, "What kind of reource to generate, can be 'event' or 'configmap'")
-	resourceCount := flag.Int("resourceCount", 100000, "How many resources to generate")
+	kubeconfig := flag.String("kubeconfig", "", "Absolute path to the kubeconfig file, defaults to $KUBECONFIG and, without either of them or -context, the in-cluster config")
+	kubeContext := flag.String("context", "", "Kubeconfig context to use instead of its current context")
+	server := flag.String("server", "", "URL of the apiserver to connect to directly, without a kubeconfig")
+	token := flag.String("token", "", "Bearer token to authenticate to -server with, better passed as $"+envName("token")+" than on the command line")
+	caFile := flag.String("caFile", "", "CA bundle to verify the apiserver with instead of the kubeconfig's, or the system roots with -server")
+	insecure := flag.Bool("insecureSkipTLSVerify", false, "Do not verify the certificate of the apiserver, for lab clusters with self-signed ones")
+	as := flag.String("as", "", "User to impersonate in every request, e.g. to exercise the flow schemas and RBAC rules matching it")
+	asGroups := flag.String("asGroup", "", "Comma separated groups to impersonate along with -as")
+	userAgent := flag.String("userAgent", "", "User-Agent of every request, for audit logs and flow schemas to tell runs apart by, defaults to 'cpburner/<run prefix>'")
+	clientQPS := flag.Float64("clientQPS", 1000, "QPS of the client-side rate limiter of every clientset, a negative value disables it and 0 means the client-go default of 5; -targetQPS and -steps replace it")
+	clientBurst := flag.Int("clientBurst", 2000, "Burst of the client-side rate limiter of every clientset")
+	flag.Int64Var(&timeout, "listTimeoutSeconds", 300, "timeoutSeconds the server is asked to finish every list and watch within")
+	flag.DurationVar(&writeTimeout, "writeTimeout", 0, "Deadline of every create, update, apply, patch and delete, after which it fails as a timeout, 0 means only -clientTimeout applies")
+	clientTimeout := flag.Duration("clientTimeout", 300*time.Second, "Timeout of every request on the client side, 0 means none")
+	resourceType := flag.String("resourceType", resourceTypeConfigMap, "What kind of resource to generate, one of "+strings.Join(burner.ResourceTypes(), ", "))
+	resourceCount := flag.Int("resourceCount", 100000, "How many resources to generate, pods to bind in 'bind' action, updates in 'conflict' action, or requests to issue in 'get', 'mix' and 'status' actions")
 	listForever := flag.Bool("listForever", false, "Do list calls again and again")
 	flag.IntVar(&concurrency, "concurrency", 10, "clientset concurrency")
+	flag.IntVar(&clientsets, "clientsets", 0, "How many clientsets the -concurrency workers of 'create' share, 0 gives every worker its own")
+	flag.StringVar(&namespace, "namespace", apiv1.NamespaceDefault, "Namespace generated objects are created in and listed, watched and deleted from, created if missing")
+	flag.IntVar(&namespaces, "namespaces", 0, "Spread generated objects over this many namespaces named -namespacePrefix and a number instead of -namespace, created if missing; watchers are spread over them as well")
+	flag.StringVar(&namespacePrefix, "namespacePrefix", "", "Name prefix of the -namespaces namespaces, defaults to -prefix followed by '-ns-'")
+	labelsFlag := flag.String("labels", "", "Comma separated labels of every object cpburner creates, e.g. 'team=perf,run=abc'")
+	flag.BoolVar(&withFinalizer, "finalizer", false, "Create objects holding the cpburner/block finalizer, so deleting them leaves them pending until 'finalize' action removes it")
+	flag.DurationVar(&ttl, "ttl", 0, "How long the objects cpburner creates live, e.g. '2h', recorded in their cpburner/expires annotation for 'clean -expired'; 0 never expires them")
+	flag.BoolVar(&expiredOnly, "expired", false, "Let 'clean' action delete only the objects whose -ttl expired, one by one")
+	flag.DurationVar(&olderThan, "olderThan", 0, "Let 'clean' action delete only the objects created longer ago than this, e.g. '24h' to leave a running experiment alone, one by one")
+	annotationsFlag := flag.String("annotations", "", "Comma separated annotations of every object cpburner creates, e.g. 'owner=perf'")
+	flag.IntVar(&payloadSize, "payloadSize", 24*1024, "Size in bytes of the random payload of every generated event or configmap")
+	payloadDistributionFlag := flag.String("payloadDistribution", "", "Draw the size in bytes of every payload from 'uniform:MIN:MAX', 'normal:MEAN:STDDEV' or 'pareto:MIN:SHAPE' instead of using -payloadSize, sizes are capped just below 1MiB")
 	flag.Int64Var(&listLimit, "listLimit", 2000, "Limit in list option")
-	action := flag.String("action", actionCreate, "one of 'create', 'list' and 'clean'")
-	flag.Parse()
+	flag.IntVar(&fieldManagers, "fieldManagers", 1, "How many field managers server-side apply each object in 'apply' action")
+	flag.StringVar(&listDecode, "listDecode", listDecodeFull, "How list responses are decoded, one of 'full' (buffer the whole response), 'stream' (decode item by item) and 'metadata' (request and stream object metadata only)")
+	flag.StringVar(&listMethod, "listMethod", listMethodChunked, "How 'list' action lists: 'chunked' pages through -listLimit objects at a time, 'watchlist' streams them with a WatchList (sendInitialEvents, needs the WatchList feature gate), 'compare' does both in turn and compares their times")
+	flag.StringVar(&listResourceVersion, "listResourceVersion", "", "resourceVersion of the lists of 'list' action: empty for a quorum read from etcd, '0' to be served from the watch cache, or a resourceVersion for -listResourceVersionMatch")
+	flag.StringVar(&listResourceVersionMatch, "listResourceVersionMatch", "", "How 'list' action matches a non-empty -listResourceVersion, 'Exact' or 'NotOlderThan'; empty keeps the legacy semantics of the apiserver")
+	flag.Int64Var(&maxListResponseBytes, "maxListResponseBytes", 0, "Abandon and count separately list responses larger than this many bytes, 0 means no limit; requires -listDecode 'stream' or 'metadata'")
+	flag.IntVar(&watchers, "watchers", 100, "How many watches to open in 'watch' action, spread over -concurrency clientsets")
+	flag.IntVar(&informers, "informers", 10, "How many shared informers 'informers' action starts, each with a clientset of its own")
+	flag.DurationVar(&informerResync, "informerResync", time.Minute, "Resync period of the informers of 'informers' action, 0 never resyncs")
+	flag.DurationVar(&bookmarkProbeInterval, "bookmarkProbeInterval", 0, "How often 'watch' action reads the current resourceVersion with a quorum list, to report how stale the watch bookmarks are; 0 only reports the intervals between bookmarks")
+	watchLabelSelectorsFlag := flag.String("watchLabelSelectors", "", "Semicolon separated label selectors cycled over the watchers of 'watch' action on top of -labelSelector, e.g. 'app=a;app=b,tier=db'")
+	flag.StringVar(&watchResourceVersion, "watchResourceVersion", "", "resourceVersion to start watches from in 'watch' action, e.g. '0' to be served from the watch cache; a comma separated list is cycled over the watchers, e.g. '0,' starts half of them from the watch cache and half from the latest version")
+	flag.StringVar(&labelSelector, "labelSelector", "", "Label selector for watches in 'watch' action, lists in 'list' action and objects to delete in 'clean' action")
+	flag.StringVar(&commonPrefix, "prefix", "evt", "Name prefix of every generated object, followed by the run start time and a random number to form the run prefix")
+	flag.Int64Var(&seed, "seed", 0, "Seed of the random payloads and uuid names and of the run prefix, so runs with the same seed and flags create byte-identical objects, 0 picks a random seed")
+	flag.StringVar(&runPrefix, "runPrefix", "", "Run prefix printed by an earlier run, 'get', 'list', 'clean' and 'verify' actions then only touch the objects of that run")
+	flag.StringVar(&checkpointFile, "checkpoint", "", "Keep the run prefix, counters and names of the objects created in this JSON file, rewritten every 10s, so a 'create' run that dies still leaves a record of what it created")
+	flag.StringVar(&resumePrefix, "resumePrefix", "", "Run prefix printed by an interrupted 'create' run to continue, creating only the names it did not; the other flags must match that run")
+	flag.StringVar(&fieldSelector, "fieldSelector", "", "Field selector for watches in 'watch' action and for objects to delete in 'clean' action")
+	flag.StringVar(&cleanStrategy, "cleanStrategy", cleanStrategyDelete, "How 'clean' action deletes objects, 'delete' (one by one), 'deletecollection' or 'namespace' (deletes -namespace or the -namespaces with everything in them)")
+	flag.StringVar(&apiservers, "apiservers", "", "Comma separated apiserver URLs to compare in 'consistency' action, defaults to the addresses of the default/kubernetes endpoints")
+	flag.DurationVar(&consistencyInterval, "consistencyInterval", 10*time.Second, "How often 'consistency' action compares the apiservers")
+	flag.StringVar(&consistencyResourceVersion, "consistencyResourceVersion", "0", "resourceVersion of the lists in 'consistency' action, '0' compares the watch caches and '' does quorum reads")
+	sweepWatchersFlag := flag.String("sweepWatchers", "10,100,1000", "Comma separated watcher counts 'watchsweep' action tries")
+	sweepTimeoutsFlag := flag.String("sweepTimeouts", "10,60,300", "Comma separated watch timeoutSeconds values 'watchsweep' action tries")
+	flag.DurationVar(&sweepDuration, "sweepDuration", 2*time.Minute, "How long 'watchsweep' action runs every combination of watcher count and timeout")
+	flag.IntVar(&storms, "storms", 1, "How many watch storms to trigger in 'watchstorm' action, or relist storms in 'relist' action, before exiting, 0 means run until killed")
+	flag.DurationVar(&stormInterval, "stormInterval", time.Minute, "Trigger a watch storm this often in 'watchstorm' action, 0 means only trigger through -stormAddr; the time between two relist storms in 'relist' action")
+	flag.StringVar(&stormAddr, "stormAddr", "", "Listen address for triggering a watch storm with 'POST /storm' in 'watchstorm' action, e.g. ':8080'")
+	flag.StringVar(&dryRun, "dryRun", dryRunNone, "'server' sends creates, updates, applies and status patches as server-side dry runs, producing admission and validation load without persisting anything; 'client' makes 'clean' action count the objects it would delete per namespace without deleting any; 'none' persists them")
+	flag.StringVar(&contentType, "contentType", contentTypeJSON, "'protobuf' sends the bodies of creates, updates and binds as application/vnd.kubernetes.protobuf, to compare the apiserver cost of ingesting it with 'json'; patches, applies and template objects keep their JSON and YAML encodings")
+	flag.StringVar(&propagationPolicy, "propagationPolicy", "", "Propagation policy of the deletes of generated objects, one of 'Background', 'Foreground' and 'Orphan', e.g. to compare the garbage collector load of Foreground deletes; empty leaves it to the server default")
+	flag.StringVar(&fieldValidation, "fieldValidation", "", "Server-side field validation of creates, updates and patches, one of 'Strict', 'Warn' and 'Ignore', empty leaves it to the server default")
+	flag.StringVar(&templateName, "template", "", "Generate realistic objects from a bundled template instead of -resourceType objects in 'create' and 'clean' actions, one of "+templateNames())
+	flag.StringVar(&nameStrategy, "nameStrategy", nameStrategySequential, "How generated objects are named after the run prefix, one of 'sequential', 'uuid', 'hashed' and 'realistic' (pod-style deployment-hash-suffix)")
+	flag.IntVar(&eventInvolvedObjects, "eventInvolvedObjects", 0, "How many distinct involved objects the generated events reference, 0 means every event references an object of its own")
+	flag.IntVar(&statusObjects, "statusObjects", 100, "How many pending pods 'status' action creates and patches the status of, -resourceType does not apply to it")
+	flag.IntVar(&bindNodes, "bindNodes", 100, "How many fake nodes 'bind' action binds pods to")
+	flag.StringVar(&webhookURL, "webhookURL", "", "URL of the webhook backend the webhook configurations of 'admission' action call")
+	flag.StringVar(&webhookService, "webhookService", "", "namespace/name of the service serving the webhook backend in 'admission' action, alternative to -webhookURL")
+	flag.StringVar(&webhookPath, "webhookPath", "/", "Path of the webhook backend behind -webhookService")
+	flag.StringVar(&webhookCAFile, "webhookCAFile", "", "CA bundle verifying the webhook backend of 'admission' action")
+	flag.IntVar(&conflictObjects, "conflictObjects", 5, "How many objects the workers of 'conflict' action contend for")
+	flag.IntVar(&conflictRetries, "conflictRetries", 10, "How many times 'conflict' action retries an update after a conflict")
+	flag.BoolVar(&allRuns, "allRuns", false, "Let 'clean' action delete the objects of every cpburner run instead of those of -runPrefix, still only objects carrying the cpburner/run label")
+	flag.BoolVar(&allNamespaces, "allNamespaces", false, "Let 'clean' action go through every namespace of the cluster instead of -namespace or the -namespaces, e.g. to remove a run spread over generated namespaces")
+	verifyPrefix := flag.String("verifyPrefix", "", "Run prefix printed by the 'create' run that 'verify' action checks, the other flags must match that run; defaults to -runPrefix")
+	pipelineFlag := flag.String("pipeline", "create,get,update,delete", "Verbs every object goes through in 'pipeline' action, starting with create")
+	flag.DurationVar(&pipelineThinkTime, "pipelineThinkTime", 0, "How long to wait between the stages of an object's pipeline in 'pipeline' action")
+	flag.DurationVar(&thinkTime, "thinkTime", 0, "How long every worker waits between its requests")
+	flag.DurationVar(&jitter, "jitter", 0, "Randomize every -thinkTime wait uniformly by up to this much either way")
+	flag.IntVar(&tuneRounds, "tuneRounds", 3, "How many full lists 'tunelimit' action averages for every page size it tries")
+	inventory := flag.Bool("inventory", true, "Record cluster version, node and apiserver counts, feature gates and APF configuration at run start")
+	mixFlag := flag.String("mix", "create=50,get=30,list=10,update=10", "Relative weights of the verbs issued by 'mix' action, verbs are create, get, list, update and delete")
+	startAtFlag := flag.String("startAt", "", "Begin the workload at this RFC3339 time or after this delay, e.g. '2022-06-01T12:00:00Z' or '5m', so instances on several machines start together")
+	flag.DurationVar(&warmup, "warmup", 0, "Send requests for this long before counting them toward any statistics, in addition to -duration")
+	flag.DurationVar(&duration, "duration", 0, "Sustain the workload of 'create', 'apply', 'get', 'list', 'mix', 'pipeline', 'status' and 'conflict' actions for this long instead of for -resourceCount requests")
+	flag.Float64Var(&targetQPS, "targetQPS", 0, "Aggregate request rate shared by all workers and clientsets, 0 means as fast as the client allows")
+	stepsFlag := flag.String("steps", "", "Stepped load profile run instead of -targetQPS and -duration, e.g. '100qps:5m,500qps:5m,1000qps:5m', statistics are reported per step")
+	flag.IntVar(&maxErrors, "maxErrors", 0, "Abort the run once more requests than this failed within -errorWindow, 0 means no limit")
+	flag.Float64Var(&maxErrorRate, "maxErrorRate", 0, "Abort the run once more than this percentage of the requests within -errorWindow failed, 0 means no limit")
+	flag.DurationVar(&errorWindow, "errorWindow", time.Minute, "Sliding window -maxErrors and -maxErrorRate are evaluated over")
+	flag.StringVar(&preRunHook, "preRunHook", "", "Shell command or http(s) webhook URL to run right before the burn starts, with the run metadata as JSON on stdin or as the POST body; the run does not start if it fails")
+	flag.StringVar(&phaseHook, "phaseHook", "", "Shell command or http(s) webhook URL to run as every -steps step starts, with the step in the JSON run metadata")
+	flag.StringVar(&postRunHook, "postRunHook", "", "Shell command or http(s) webhook URL to run once the run is reported, with its counters and outcome in the JSON run metadata")
+	flag.DurationVar(&hookTimeout, "hookTimeout", 5*time.Minute, "How long a -preRunHook, -phaseHook or -postRunHook may take")
+	flag.StringVar(&leaseName, "leaseName", "", "Elect a leader among the replicas of a run through this Lease, only the leader runs 'clean' actions and -cleanOnAbort or -cleanOnInterrupt cleanups while all of them generate load")
+	flag.StringVar(&leaseNamespace, "leaseNamespace", apiv1.NamespaceDefault, "Namespace of the -leaseName Lease")
+	flag.DurationVar(&shutdownTimeout, "shutdownTimeout", 30*time.Second, "How long the requests in flight may take to drain after a SIGINT or SIGTERM before cpburner reports the run and exits anyway")
+	flag.BoolVar(&cleanOnInterrupt, "cleanOnInterrupt", false, "Run 'clean' action after reporting a run stopped by SIGINT or SIGTERM")
+	flag.BoolVar(&cleanOnAbort, "cleanOnAbort", false, "Run 'clean' action before exiting on -maxErrors or -maxErrorRate")
+	requestLogFlag := flag.String("requestLog", "", "Write one line per request with its time, verb, resource, duration, HTTP code and error to this file, as CSV if it ends in '.csv' and as NDJSON otherwise")
+	timeseriesFlag := flag.String("timeseries", "", "Write the request rate, error rate and mean latency of every -timeseriesInterval to this file, as CSV if it ends in '.csv' and as NDJSON otherwise")
+	flag.DurationVar(&timeseriesInterval, "timeseriesInterval", time.Second, "Window of every -timeseries point")
+	flag.StringVar(&resultsNamespace, "resultsNamespace", "", "Store the JSON summary of the run in a ConfigMap named after the run prefix in this namespace, created if missing")
+	flag.BoolVar(&perWorkerStats, "perWorkerStats", false, "Report request counts, failures and latency of every worker clientset at the end, to spot those that fall behind")
+	sloFlag := flag.String("slo", "", "Comma separated objectives the run has to meet or exit non-zero, e.g. 'p99-latency=1s,create:p50-latency=100ms,error-rate=1%', latency objectives are 'mean', 'p50', 'p90', 'p99' and 'p999', optionally for one verb")
+	flag.StringVar(&outputJUnit, "outputJUnit", "", "Write the run as a JUnit XML test suite to this file at the end, with a test case for every check such as -maxErrors and 'verify' action and one per verb")
+	flag.StringVar(&aggregateRun, "aggregateRun", "", "Name shared by replicas running the same load: their reports stored in -resultsNamespace are labelled with it, and 'report' action given it merges them into one, summing totals and merging latency histograms; the shards of a distributed run share its run prefix")
+	flag.StringVar(&outputJSON, "outputJSON", "", "Write a JSON summary of the run, with its parameters, totals, errors by code and latency percentiles, to this file at the end")
+	flag.BoolVar(&dashboard, "dashboard", false, "Show a dashboard of request rates, in-flight requests, failures by class and latency that refreshes in place every second, instead of the status line every 10 seconds")
+	flag.StringVar(&tracingEndpoint, "tracingEndpoint", "", "OTLP gRPC collector, e.g. 'localhost:4317', to export a span for every request to, propagating the trace context to the apiserver")
+	flag.Float64Var(&tracingSampleRate, "tracingSampleRate", 1, "Fraction of the requests traced with -tracingEndpoint")
+	flag.StringVar(&pushgatewayURL, "pushgatewayURL", "", "Prometheus Pushgateway to push the metrics of the run to every -pushInterval and at the end, e.g. 'http://pushgateway:9091'")
+	flag.DurationVar(&pushInterval, "pushInterval", 30*time.Second, "How often metrics are pushed to -pushgatewayURL")
+	flag.StringVar(&pprofAddr, "pprofAddr", "", "Listen address for serving net/http/pprof profiles of cpburner itself on '/debug/pprof/', e.g. ':6060'")
+	flag.StringVar(&grpcAddr, "grpcAddr", "", "Listen address for serving the cpburner.Control gRPC service, which starts, stops and changes the -targetQPS of the run and streams its statistics, e.g. ':9091'")
+	flag.StringVar(&controlAddr, "controlAddr", "", "Listen address for serving the HTTP control API of the run, e.g. ':8081': POST /start and /stop, GET /status, and GET or POST {\"targetQPS\": <qps>} on /config")
+	flag.IntVar(&maxConcurrency, "maxConcurrency", 0, "Start this many workers of which -concurrency issue requests, so the SetConcurrency call of -grpcAddr can change the concurrency of a running -duration run up to it; only for 'create', 'apply', 'get', 'pipeline' and 'status' actions")
+	flag.BoolVar(&waitForStart, "waitForStart", false, "Wait with the run until -grpcAddr or -controlAddr is asked to start it")
+	flag.StringVar(&metricsAddr, "metricsAddr", "", "Listen address for serving Prometheus metrics of the run on '/metrics', e.g. ':9090'")
+	flag.IntVar(&maxInflight, "maxInflight", 0, "Cap on requests outstanding at once across all workers, watches excluded, 0 means no cap")
+	flag.BoolVar(&openLoop, "openLoop", false, "Start the requests of 'create', 'apply', 'get', 'pipeline' and 'status' actions on the -targetQPS or -steps schedule whether earlier ones completed or not, instead of every worker waiting for its previous request")
+	flag.DurationVar(&rampUp, "rampUp", 0, "Raise the request rate linearly from zero to -targetQPS over this long at the start of the run")
+	flag.DurationVar(&rampDown, "rampDown", 0, "Lower the request rate linearly from -targetQPS to zero over the last this long of a -duration run")
+	flag.DurationVar(&wavePeriod, "wavePeriod", time.Hour, "Period of the sinusoidal load shape enabled by -waveAmplitude")
+	flag.Float64Var(&waveAmplitude, "waveAmplitude", 0, "Let the request rate oscillate around -targetQPS by this fraction of it, between 0 and 1, e.g. 0.5 swings between half and one and a half times -targetQPS")
+	flag.DurationVar(&burstInterval, "burstInterval", 0, "Inject a burst of -burstFactor times -targetQPS at the end of every interval this long, statistics are reported per burst, 0 disables bursts")
+	flag.DurationVar(&burstDuration, "burstDuration", 10*time.Second, "How long every burst enabled by -burstInterval lasts")
+	flag.Float64Var(&burstFactor, "burstFactor", 10, "Request rate of bursts as a multiple of -targetQPS")
+	flag.StringVar(&outputStream, "outputStream", "", "Write NDJSON records to stdout and everything else to stderr, 'requests' emits one record per request and 'status' one record per status line")
+	flag.StringVar(&operatorNamespace, "operatorNamespace", "", "Namespace of the CpBurnerRuns 'operator' runs, empty means all namespaces")
+	flag.StringVar(&manifestCommand, "manifestCommand", actionCreate, "Command the 'manifest' Job or Deployment runs")
+	flag.StringVar(&manifestKind, "manifestKind", manifestKindJob, "What 'manifest' prints, 'job' for runs that end or 'deployment' for load that runs until deleted")
+	flag.StringVar(&manifestImage, "image", "largeclustere2e.azurecr.io/test/cpburner:v20220630.1", "cpburner image of the 'manifest' pods")
+	flag.StringVar(&manifestNamespace, "manifestNamespace", apiv1.NamespaceDefault, "Namespace of the 'manifest' workload and ServiceAccount")
+	flag.IntVar(&manifestReplicas, "manifestReplicas", 1, "Pods of the 'manifest' workload, Job parallelism and completions or Deployment replicas")
+	flag.StringVar(&coordinatorListen, "coordinatorListen", "", "Coordinate a distributed run on this address, e.g. ':8090': hand every one of -expectWorkers workers a shard of the run these flags describe and add up the statistics they send back, instead of running it")
+	flag.IntVar(&expectWorkers, "expectWorkers", 0, "How many workers the -coordinatorListen coordinator splits the run over, the shards start together once all of them registered")
+	flag.DurationVar(&shardTimeout, "shardTimeout", time.Minute, "How long the -coordinatorListen coordinator waits to hear from a worker before it counts its shard as failed")
+	flag.StringVar(&coordinatorURL, "coordinator", "", "Run a shard of the distributed run of the coordinator at this URL, e.g. 'http://coordinator:8090', taking all flags but the connection and output ones from it")
+	configFlag := flag.String("config", "", "YAML scenario file setting any of these flags by name, e.g. 'action: mix' or 'concurrency: 20', plus 'phases', a list of 'qps' and 'duration' run like -steps; flags given on the command line or through the environment take precedence")
+	action := flag.String("action", actionCreate, "Command to run when it is not given as 'cpburner <command>', one of 'create', 'apply', 'list', 'get', 'verify', 'mix', 'pipeline', 'status', 'bind', 'admission', 'conflict', 'watch', 'watchstorm', 'watchsweep', 'consistency', 'tunelimit', 'clean', 'report', 'operator' and 'manifest'")
+	parseCommandLine()
+	if err := loadEnvironment(); err != nil {
+		usageError("environment: %s", err)
+	}
+	if *configFlag != "" {
+		if err := loadScenario(*configFlag); err != nil {
+			usageError("-config: %s", err)
+		}
+	}
+	if *action == actionManifest {
+		printManifest()
+		return
+	}
+	if waitForStart && grpcAddr == "" && controlAddr == "" {
+		usageError("-waitForStart needs -grpcAddr or -controlAddr to serve a control API that starts the run")
+	}
+	if coordinatorURL != "" && coordinatorListen != "" {
+		usageError("-coordinator and -coordinatorListen cannot be combined, a process is either a worker or the coordinator")
+	}
+	if coordinatorListen != "" && expectWorkers < 1 {
+		usageError("-coordinatorListen needs -expectWorkers of at least 1")
+	}
+	if coordinatorURL != "" {
+		if err := joinCoordinator(); err != nil {
+			usageError("-coordinator: %s", err)
+		}
+		defer failShardOnPanic()
+		go sendStatsPeriodically()
+	}
 
-	if *resourceType != resourceTypeEvent && *resourceType != resourceTypeConfigMap {
-		fmt.Println("error resourceType")
-		os.Exit(1)
+	if outputStream != "" && outputStream != outputStreamRequests && outputStream != outputStreamStatus {
+		usageError("-outputStream must be %q or %q, not %q", outputStreamRequests, outputStreamStatus, outputStream)
+	}
+	if outputStream != "" {
+		out = os.Stderr
+	}
+	if lookupCommand(*action) == nil {
+		usageError("unknown action %q", *action)
+	}
+	if *resourceCount < 0 {
+		usageError("-resourceCount must not be negative")
+	}
+	if concurrency < 1 {
+		usageError("-concurrency must be at least 1")
+	}
+	if clientsets < 0 {
+		usageError("-clientsets must not be negative, 0 gives every worker its own clientset")
+	}
+	if listLimit < 0 {
+		usageError("-listLimit must not be negative, 0 lists everything in one page")
+	}
+	if burner.Generator(*resourceType) == nil {
+		usageError("-resourceType must be one of %s, not %q", strings.Join(burner.ResourceTypes(), ", "), *resourceType)
+	}
+	if payloadSize < 0 {
+		usageError("-payloadSize must not be negative")
+	}
+	if fieldManagers < 1 {
+		usageError("-fieldManagers must be at least 1")
+	}
+	if listDecode != listDecodeFull && listDecode != listDecodeStream && listDecode != listDecodeMetadata {
+		usageError("-listDecode must be %q, %q or %q, not %q", listDecodeFull, listDecodeStream, listDecodeMetadata, listDecode)
+	}
+	mix, err := parseMix(*mixFlag)
+	if err != nil {
+		usageError("-mix: %s", err)
+	}
+	payloadDistribution, err = parsePayloadDistribution(*payloadDistributionFlag)
+	if err != nil {
+		usageError("-payloadDistribution: %s", err)
+	}
+	if _, ok := objectTemplates[templateName]; templateName != "" && !ok {
+		usageError("-template %q is not bundled, one of %s", templateName, templateNames())
+	}
+	if fieldValidation != "" && fieldValidation != metav1.FieldValidationStrict && fieldValidation != metav1.FieldValidationWarn && fieldValidation != metav1.FieldValidationIgnore {
+		usageError("-fieldValidation must be %q, %q, %q or empty, not %q", metav1.FieldValidationStrict, metav1.FieldValidationWarn, metav1.FieldValidationIgnore, fieldValidation)
+	}
+	if propagationPolicy != "" && propagationPolicy != string(metav1.DeletePropagationBackground) && propagationPolicy != string(metav1.DeletePropagationForeground) && propagationPolicy != string(metav1.DeletePropagationOrphan) {
+		usageError("-propagationPolicy must be %q, %q, %q or empty, not %q", metav1.DeletePropagationBackground, metav1.DeletePropagationForeground, metav1.DeletePropagationOrphan, propagationPolicy)
+	}
+	if dryRun != dryRunNone && dryRun != dryRunServer && dryRun != dryRunClient {
+		usageError("-dryRun must be %q, %q or %q, not %q", dryRunNone, dryRunServer, dryRunClient, dryRun)
+	}
+	if dryRun == dryRunClient && *action != actionClean {
+		usageError("-dryRun %s only applies to %s", dryRunClient, actionClean)
+	}
+	if dryRun == dryRunServer && *action == actionClean {
+		usageError("%s does not send server-side dry runs, -dryRun %s previews what it would delete", actionClean, dryRunClient)
+	}
+	if contentType != contentTypeJSON && contentType != contentTypeProtobuf {
+		usageError("-contentType must be %q or %q, not %q", contentTypeJSON, contentTypeProtobuf, contentType)
+	}
+	if nameStrategy != nameStrategySequential && nameStrategy != nameStrategyUUID && nameStrategy != nameStrategyHashed && nameStrategy != nameStrategyRealistic {
+		usageError("-nameStrategy must be %q, %q, %q or %q, not %q", nameStrategySequential, nameStrategyUUID, nameStrategyHashed, nameStrategyRealistic, nameStrategy)
+	}
+	if tuneRounds < 1 {
+		usageError("-tuneRounds must be at least 1")
+	}
+	if *action == actionAdmission && (webhookURL == "") == (webhookService == "") {
+		usageError("%s needs exactly one of -webhookURL and -webhookService", actionAdmission)
+	}
+	if *action == actionReport && resultsNamespace == "" {
+		usageError("%s needs -resultsNamespace", actionReport)
+	}
+	if errs := validation.IsValidLabelValue(aggregateRun); len(errs) > 0 {
+		usageError("-aggregateRun %q: %s", aggregateRun, strings.Join(errs, ", "))
+	}
+	if errs := validation.IsDNS1123Label(commonPrefix); len(errs) > 0 {
+		usageError("-prefix %q: %s", commonPrefix, strings.Join(errs, ", "))
+	}
+	if resumePrefix != "" && (*action != actionCreate || templateName != "" || (nameStrategy == nameStrategyUUID && seed == 0)) {
+		usageError("-resumePrefix only resumes %s runs without -template, and uuid names only with the -seed of the resumed run", actionCreate)
+	}
+	if seed != 0 {
+		globalPrefix = fmt.Sprintf("%s-seed%d", commonPrefix, seed)
+	} else {
+		seed = time.Now().UnixNano()
+		globalPrefix = fmt.Sprintf("%s-%d-%d", commonPrefix, time.Now().Unix(), rand.Intn(9999))
+	}
+	if checkpointFile != "" && templateName != "" {
+		usageError("-checkpoint does not apply to -template runs")
+	}
+	if resumePrefix != "" {
+		globalPrefix, runPrefix = resumePrefix, resumePrefix
+	}
+	if assignment != nil {
+		globalPrefix = fmt.Sprintf("%s-w%d", assignment.Prefix, assignment.Shard)
+		seed = assignment.Seed + int64(assignment.Shard)
+		if aggregateRun == "" {
+			aggregateRun = assignment.Prefix
+		}
+	}
+	rand.Seed(seed)
+	initPayload()
+	if namespacePrefix == "" {
+		namespacePrefix = commonPrefix + "-ns-"
+	}
+	if *verifyPrefix == "" {
+		*verifyPrefix = runPrefix
+	}
+	if *action == actionClean && runPrefix == "" && !allRuns {
+		usageError("%s needs -runPrefix to delete the objects of that run, or -allRuns to delete those of every run", actionClean)
+	}
+	if runPrefix != "" && allRuns {
+		usageError("-runPrefix and -allRuns cannot be combined")
+	}
+	if *action == actionVerify && *verifyPrefix == "" {
+		usageError("%s needs -verifyPrefix or -runPrefix", actionVerify)
+	}
+	if conflictObjects < 1 || conflictRetries < 0 {
+		usageError("-conflictObjects must be at least 1 and -conflictRetries not negative")
+	}
+	if bindNodes < 1 {
+		usageError("-bindNodes must be at least 1")
+	}
+	if statusObjects < 1 {
+		usageError("-statusObjects must be at least 1")
+	}
+	if eventInvolvedObjects < 0 {
+		usageError("-eventInvolvedObjects must not be negative")
+	}
+	stages, err := parsePipeline(*pipelineFlag)
+	if err != nil {
+		usageError("-pipeline: %s", err)
+	}
+	if pipelineThinkTime < 0 {
+		usageError("-pipelineThinkTime must not be negative")
+	}
+	if cleanStrategy != cleanStrategyDelete && cleanStrategy != cleanStrategyDeleteCollection && cleanStrategy != cleanStrategyNamespace {
+		usageError("-cleanStrategy must be %q, %q or %q, not %q", cleanStrategyDelete, cleanStrategyDeleteCollection, cleanStrategyNamespace, cleanStrategy)
+	}
+	if objectLabels, err = parseLabels(*labelsFlag); err != nil {
+		usageError("-labels: %s", err)
+	}
+	if objectAnnotations, err = parseKeyValues(*annotationsFlag); err != nil {
+		usageError("-annotations: %s", err)
+	}
+	if namespaces < 0 {
+		usageError("-namespaces must not be negative")
+	}
+	if ttl < 0 {
+		usageError("-ttl must not be negative")
+	}
+	if expiredOnly && *action != actionClean {
+		usageError("-expired only applies to %s", actionClean)
+	}
+	if expiredOnly && cleanStrategy != cleanStrategyDelete {
+		usageError("-expired checks the expiry of every object, it needs -cleanStrategy %s", cleanStrategyDelete)
+	}
+	if olderThan < 0 {
+		usageError("-olderThan must not be negative")
+	}
+	if olderThan > 0 && *action != actionClean {
+		usageError("-olderThan only applies to %s", actionClean)
+	}
+	if olderThan > 0 && cleanStrategy != cleanStrategyDelete {
+		usageError("-olderThan checks the age of every object, it needs -cleanStrategy %s", cleanStrategyDelete)
+	}
+	if allNamespaces && *action != actionClean && *action != actionOrphans {
+		usageError("-allNamespaces only applies to %s and %s", actionClean, actionOrphans)
+	}
+	if allNamespaces && namespaces > 0 {
+		usageError("-allNamespaces and -namespaces cannot be combined")
+	}
+	if *action == actionClean && cleanStrategy == cleanStrategyNamespace && !allRuns {
+		usageError("-cleanStrategy %s deletes the objects of every run in the namespaces, it needs -allRuns", cleanStrategyNamespace)
+	}
+	// -allNamespaces leaves the system namespaces out once it lists them
+	for _, ns := range targetNamespaces() {
+		if cleanStrategy == cleanStrategyNamespace && systemNamespace(ns) && !allNamespaces {
+			usageError("-cleanStrategy %s refuses to delete system namespace %s", cleanStrategyNamespace, ns)
+		}
+	}
+	if consistencyInterval <= 0 {
+		usageError("-consistencyInterval must be positive")
+	}
+	if watchers < 1 {
+		usageError("-watchers must be at least 1")
+	}
+	if informers < 1 {
+		usageError("-informers must be at least 1")
+	}
+	if bookmarkProbeInterval < 0 {
+		usageError("-bookmarkProbeInterval must not be negative")
+	}
+	if informerResync < 0 {
+		usageError("-informerResync must not be negative")
+	}
+	watchResourceVersions = strings.Split(watchResourceVersion, ",")
+	if *watchLabelSelectorsFlag != "" {
+		watchLabelSelectors = strings.Split(*watchLabelSelectorsFlag, ";")
+	}
+	sweepWatchers, err := parseIntList(*sweepWatchersFlag)
+	if err != nil {
+		usageError("-sweepWatchers: %s", err)
+	}
+	sweepTimeouts, err := parseIntList(*sweepTimeoutsFlag)
+	if err != nil {
+		usageError("-sweepTimeouts: %s", err)
+	}
+	if sweepDuration <= 0 {
+		usageError("-sweepDuration must be positive")
+	}
+	if storms < 0 || stormInterval < 0 {
+		usageError("-storms and -stormInterval must not be negative")
+	}
+	if *action == actionWatchStorm && stormInterval == 0 && stormAddr == "" {
+		usageError("%s needs -stormInterval or -stormAddr to trigger storms", actionWatchStorm)
+	}
+	startAt, err := parseStartAt(*startAtFlag, time.Now())
+	if err != nil {
+		usageError("-startAt: %s", err)
+	}
+	if warmup < 0 {
+		usageError("-warmup must not be negative")
+	}
+	if duration < 0 {
+		usageError("-duration must not be negative")
+	}
+	if targetQPS < 0 {
+		usageError("-targetQPS must not be negative")
+	}
+	steps, err = parseSteps(*stepsFlag)
+	if err != nil {
+		usageError("-steps: %s", err)
+	}
+	if len(steps) > 0 && (targetQPS > 0 || duration > 0 || rampUp > 0 || rampDown > 0) {
+		usageError("-steps sets rates and durations itself, it cannot be combined with -targetQPS, -duration, -rampUp or -rampDown")
+	}
+	for _, step := range steps {
+		duration += step.duration
+	}
+	shardLoad(resourceCount)
+	if duration == 0 && *resourceCount < concurrency && lookupCommand(*action).accepts("resourceCount") {
+		usageError("-resourceCount %d is split over -concurrency %d workers, so none of them would issue a request", *resourceCount, concurrency)
+	}
+	if thinkTime < 0 || jitter < 0 {
+		usageError("-thinkTime and -jitter must not be negative")
+	}
+	if maxErrors < 0 || maxErrorRate < 0 || maxErrorRate > 100 {
+		usageError("-maxErrors must not be negative and -maxErrorRate must be a percentage between 0 and 100")
+	}
+	if errorWindow < time.Second {
+		usageError("-errorWindow must be at least 1s")
+	}
+	if *requestLogFlag != "" {
+		if requestLog, err = openRequestLog(*requestLogFlag); err != nil {
+			usageError("-requestLog: %s", err)
+		}
+	}
+	if tracingSampleRate < 0 || tracingSampleRate > 1 {
+		usageError("-tracingSampleRate must be between 0 and 1")
+	}
+	slos, err := parseSLOs(*sloFlag)
+	if err != nil {
+		usageError("-slo: %s", err)
+	}
+	if pushInterval <= 0 {
+		usageError("-pushInterval must be positive")
+	}
+	var timeseries *timeseriesFile
+	if *timeseriesFlag != "" {
+		if timeseriesInterval <= 0 {
+			usageError("-timeseriesInterval must be positive")
+		}
+		if timeseries, err = openTimeseries(*timeseriesFlag); err != nil {
+			usageError("-timeseries: %s", err)
+		}
+	}
+	if *clientQPS > 0 && *clientBurst < 1 {
+		usageError("-clientBurst must be at least 1 with a positive -clientQPS")
+	}
+	if *clientTimeout < 0 || writeTimeout < 0 {
+		usageError("-clientTimeout and -writeTimeout must not be negative")
+	}
+	if timeout < 1 {
+		usageError("-listTimeoutSeconds must be at least 1")
+	}
+	if maxInflight < 0 {
+		usageError("-maxInflight must not be negative")
+	}
+	if maxConcurrency > 0 && (maxConcurrency < concurrency || duration == 0 || openLoop) {
+		usageError("-maxConcurrency must be at least -concurrency and needs -duration without -openLoop, parked workers would never issue their share of -resourceCount")
+	}
+	if maxConcurrency > 0 && (templateName != "" || *action != actionCreate) && *action != actionApply && *action != actionGet && *action != actionPipeline && *action != actionStatus {
+		usageError("-maxConcurrency is not supported by %s", *action)
+	}
+	if maxConcurrency > 0 {
+		gate = newWorkerGate(concurrency, maxConcurrency)
+		concurrency = maxConcurrency
+	}
+	if openLoop && targetQPS == 0 && len(steps) == 0 {
+		usageError("-openLoop needs -targetQPS or -steps to schedule requests by")
+	}
+	if openLoop && (templateName != "" || *action != actionCreate) && *action != actionApply && *action != actionGet && *action != actionPipeline && *action != actionStatus {
+		usageError("-openLoop is not supported by %s", *action)
+	}
+	if rampUp < 0 || rampDown < 0 || ((rampUp > 0 || rampDown > 0) && targetQPS == 0) {
+		usageError("-rampUp and -rampDown must not be negative and need -targetQPS")
+	}
+	if waveAmplitude < 0 || waveAmplitude > 1 || (waveAmplitude > 0 && (targetQPS == 0 || wavePeriod <= 0)) {
+		usageError("-waveAmplitude must be between 0 and 1 and needs -targetQPS and a positive -wavePeriod")
+	}
+	if burstInterval < 0 || (burstInterval > 0 && (targetQPS == 0 || burstDuration <= 0 || burstDuration >= burstInterval || burstFactor < 1)) {
+		usageError("-burstInterval needs -targetQPS, a positive -burstDuration shorter than it and a -burstFactor of at least 1")
+	}
+	if rampDown > 0 && (duration == 0 || rampUp+rampDown > duration) {
+		usageError("-rampDown needs a -duration covering -rampUp and -rampDown")
+	}
+	if listMethod != listMethodChunked && listMethod != listMethodWatchList && listMethod != listMethodCompare {
+		usageError("-listMethod must be %q, %q or %q, not %q", listMethodChunked, listMethodWatchList, listMethodCompare, listMethod)
+	}
+	if listMethod != listMethodChunked && (listDecode != listDecodeFull || listResourceVersionMatch != "") {
+		usageError("-listMethod %s decodes watch events and matches resourceVersions NotOlderThan, it takes neither -listDecode nor -listResourceVersionMatch", listMethod)
+	}
+	if listResourceVersionMatch != "" && listResourceVersionMatch != string(metav1.ResourceVersionMatchExact) && listResourceVersionMatch != string(metav1.ResourceVersionMatchNotOlderThan) {
+		usageError("-listResourceVersionMatch must be %q, %q or empty, not %q", metav1.ResourceVersionMatchExact, metav1.ResourceVersionMatchNotOlderThan, listResourceVersionMatch)
+	}
+	if listResourceVersionMatch != "" && listResourceVersion == "" {
+		usageError("-listResourceVersionMatch needs a -listResourceVersion")
+	}
+	if listResourceVersionMatch == string(metav1.ResourceVersionMatchExact) && listResourceVersion == "0" {
+		usageError("-listResourceVersionMatch %s needs a -listResourceVersion other than 0", metav1.ResourceVersionMatchExact)
+	}
+	if maxListResponseBytes < 0 || (maxListResponseBytes > 0 && listDecode == listDecodeFull) {
+		usageError("-maxListResponseBytes must not be negative and needs -listDecode %s or %s", listDecodeStream, listDecodeMetadata)
 	}
 
-	var config *rest.Config
-	var err error
-	if *kubeconfig == "" {
-		config, err = rest.InClusterConfig()
+	if *asGroups != "" && *as == "" {
+		usageError("-asGroup needs -as")
+	}
+	if (*server != "" && (*kubeconfig != "" || *kubeContext != "")) || (*server == "" && *token != "") {
+		usageError("-server and -token connect without a kubeconfig, they cannot be combined with -kubeconfig or -context, and -token needs -server")
+	}
+	if *caFile != "" && *insecure {
+		usageError("-caFile and -insecureSkipTLSVerify cannot be combined")
+	}
+	if coordinatorListen != "" {
+		coordinate()
+	}
+	config, err := loadConfig(*kubeconfig, *kubeContext, *server, *token)
+	if err != nil {
+		panic(err)
+	}
+	if *caFile != "" {
+		config.CAFile, config.CAData = *caFile, nil
+	}
+	if *insecure {
+		// client-go refuses root certificates along with Insecure
+		config.Insecure, config.CAFile, config.CAData = true, "", nil
+	}
+	if *as != "" {
+		config.Impersonate = rest.ImpersonationConfig{UserName: *as}
+		if *asGroups != "" {
+			config.Impersonate.Groups = strings.Split(*asGroups, ",")
+		}
+	}
+	config.UserAgent = *userAgent
+	if config.UserAgent == "" {
+		config.UserAgent = "cpburner/" + globalPrefix
+	}
+	config.QPS = float32(*clientQPS)
+	config.Burst = *clientBurst
+	config.Timeout = *clientTimeout
+	if contentType == contentTypeProtobuf {
+		// responses stay JSON, so only the encoding of writes differs
+		config.ContentType = runtime.ContentTypeProtobuf
+		config.AcceptContentTypes = runtime.ContentTypeJSON
+	}
+	if maxInflight > 0 {
+		config.Wrap(newInflightLimiter(maxInflight))
+	}
+	config.Wrap(func(next http.RoundTripper) http.RoundTripper { return &apfRecorder{next: next} })
+	if tracingEndpoint != "" {
+		defer setupTracing(context.Background())()
+		config.Wrap(newTracingTransport)
+	}
+	if metricsAddr != "" || pushgatewayURL != "" || dashboard {
+		config.Wrap(func(next http.RoundTripper) http.RoundTripper { return &inflightTracker{next: next} })
+	}
+	if metricsAddr != "" {
+		serveMetrics()
+	}
+	if pprofAddr != "" {
+		servePprof()
+	}
+	if grpcAddr != "" {
+		serveGRPC()
+	}
+	if controlAddr != "" {
+		serveControl()
+	}
+	if pushgatewayURL != "" {
+		go pushMetricsPeriodically()
+	}
+
+	if *action == actionReport && aggregateRun != "" {
+		printAggregateReport(config)
+		return
+	} else if *action == actionReport {
+		printStoredReports(config)
+		return
+	}
+	if *action == actionOperator {
+		runOperator(config)
+		return
+	}
+	if *action == actionOrphans {
+		if err := printOrphans(config, *resourceType); err != nil {
+			fmt.Fprintf(out, "%s failed: %s\n", actionOrphans, err)
+			sendFinalStats(false)
+			os.Exit(1)
+		}
+		return
+	}
+	handleSignals(config, *resourceType)
+	if leaseName != "" {
+		electLeader(config)
+	}
+
+	if (namespaces > 0 || namespace != apiv1.NamespaceDefault) && *action != actionClean && *action != actionVerify && *action != actionFinalize {
+		clientset, err := kubernetes.NewForConfig(config)
 		if err != nil {
-			panic(err.Error())
+			panic(err)
 		}
+		for _, ns := range targetNamespaces() {
+			if err := ensureNamespace(context.Background(), clientset, ns, generatedLabels()); err != nil {
+				panic(err)
+			}
+		}
+	}
+	report = runReport{SchemaVersion: schemaVersion, RunPrefix: globalPrefix, StartTime: time.Now(), Action: *action, ResourceType: *resourceType}
+	if *inventory {
+		report.Cluster = collectInventory(context.Background(), config)
+		printInventory(report.Cluster)
+	}
+
+	if dashboard {
+		go runDashboard()
 	} else {
-		config, err = clientcmd.BuildConfigFromFlags("", *kubeconfig)
+		go func() {
+			for {
+				time.Sleep(time.Second * 10)
+				showStatus()
+			}
+		}()
+	}
+
+	if waitForStart {
+		fmt.Fprintln(out, "waiting for a start request")
+		<-startRequest
+	}
+	if wait := time.Until(startAt); wait > 0 {
+		fmt.Fprintf(out, "waiting %s until %s to start\n", wait.Round(time.Second), startAt.Format(time.RFC3339))
+		time.Sleep(wait)
+	}
+	if err := runHook(preRunHook, newHookEvent(hookPreRun)); err != nil {
+		fmt.Fprintf(out, "pre-run hook failed, not starting the run: %s\n", err)
+		sendFinalStats(false)
+		os.Exit(1)
+	}
+	start := time.Now()
+	warmupEnd = start.Add(warmup)
+	if duration > 0 {
+		deadline = warmupEnd.Add(duration)
+	}
+	if warmup > 0 {
+		go func() {
+			time.Sleep(warmup)
+			fmt.Fprintf(out, "warmup over, %d requests not counted\n", atomic.LoadInt64(&counterWarmup))
+		}()
+	}
+	if openLoop {
+		schedule = newPacer(start)
+		activePacer = schedule
+		config.RateLimiter = flowcontrol.NewFakeAlwaysRateLimiter()
+	} else if targetQPS > 0 || len(steps) > 0 {
+		// every clientset built from config from here on shares this one bucket
+		activePacer = newPacer(start)
+		config.RateLimiter = activePacer
+	}
+	if len(steps) > 0 {
+		go reportSteps(start)
+	}
+	if burstInterval > 0 {
+		go reportBursts(start)
+	}
+	if timeseries != nil {
+		go timeseries.run(start)
+	}
+	if maxErrors > 0 || maxErrorRate > 0 {
+		go abortOnErrors(config, *resourceType)
+	}
+	if createsObjects(*action) {
+		fmt.Fprintf(out, "run prefix: %s\n", globalPrefix)
+	}
+	leader := true
+	if *action == actionClean {
+		var err error
+		if leader, err = waitForLeader(); err != nil {
+			failRun(config, actionClean, err)
+		}
+	}
+	if *action == actionClean && allNamespaces && leader {
+		clientset, err := kubernetes.NewForConfig(config)
 		if err != nil {
 			panic(err)
 		}
+		if err := useClusterNamespaces(context.Background(), clientset); err != nil {
+			failRun(config, actionClean, err)
+		}
 	}
-	config.QPS = 1000
-	config.Burst = 2000
-	config.Timeout = time.Second * 300
-
-	go func() {
-		for {
-			time.Sleep(time.Second * 10)
-			showStatus()
+	if *action == actionClean && !leader {
+		fmt.Fprintf(out, "leaving 'clean' to the leader %s\n", leaderName())
+	} else if *action == actionCreate && templateName != "" {
+		genFromTemplate(config, *resourceCount, templateName)
+	} else if *action == actionClean && dryRun == dryRunClient {
+		if err := previewClean(config, *resourceType); err != nil {
+			failRun(config, actionClean, err)
+		}
+	} else if *action == actionClean && templateName != "" && !filtersObjects() {
+		cleanTemplateObjects(config, templateName)
+	} else if *action == actionCreate {
+		if err := gen(config, *resourceCount, *resourceType); err != nil {
+			failRun(config, actionCreate, err)
+		}
+	} else if *action == actionApply {
+		apply(config, *resourceCount, *resourceType)
+	} else if *action == actionGet {
+		if err := get(config, *resourceCount, *resourceType); err != nil {
+			failRun(config, actionGet, err)
+		}
+	} else if *action == actionWatch {
+		watchAction(config, *resourceType)
+	} else if *action == actionInformers {
+		runInformers(config, *resourceType)
+	} else if *action == actionRelist {
+		relistStorm(config, *resourceType)
+	} else if *action == actionWatchStorm {
+		watchStorm(config, *resourceType)
+	} else if *action == actionWatchSweep {
+		sweepWatchTimeouts(config, *resourceType, sweepWatchers, sweepTimeouts)
+	} else if *action == actionConsistency {
+		checkConsistency(config, *resourceType)
+	} else if *action == actionMix {
+		mixedLoad(config, *resourceCount, *resourceType, mix)
+	} else if *action == actionStatus {
+		if err := statusStorm(config, *resourceCount); err != nil {
+			failRun(config, actionStatus, err)
+		}
+	} else if *action == actionPipeline {
+		pipelineLoad(config, *resourceCount, *resourceType, stages)
+	} else if *action == actionTuneListLimit {
+		tuneListLimit(config, *resourceType)
+	} else if *action == actionBind {
+		bindPods(config, *resourceCount)
+	} else if *action == actionAdmission {
+		admissionBreakdown(config, *resourceCount, *resourceType)
+	} else if *action == actionConflict {
+		conflictStorm(config, *resourceCount, *resourceType)
+	} else if *action == actionVerify {
+		if ok, err := verify(config, *resourceCount, *resourceType, *verifyPrefix); err != nil {
+			failRun(config, actionVerify, err)
+		} else if !ok {
+			failRun(config, actionVerify, errors.New("objects of the create run missing or unexpected"))
+		}
+		addCheck(actionVerify, true, "")
+	} else if *action == actionFinalize {
+		if err := finalize(config, *resourceType); err != nil {
+			failRun(config, actionFinalize, err)
 		}
-	}()
-
-	if *action == actionCreate {
-		gen(config, *resourceCount, *resourceType)
 	} else if *action == actionClean {
-		cleanup(config, *resourceType)
+		if err := cleanup(config, *resourceType); err != nil {
+			failRun(config, actionClean, err)
+		}
 	} else if *action == actionList {
+		var err error
 		if *listForever {
-			for {
-				list(config, *resourceType)
+			for err == nil {
+				err = list(config, *resourceType)
+			}
+		} else if duration > 0 {
+			for err == nil && time.Now().Before(deadline) && !stopRequested() {
+				err = list(config, *resourceType)
 			}
 		} else {
-			list(config, *resourceType)
-
+			err = list(config, *resourceType)
+		}
+		if err != nil {
+			failRun(config, actionList, err)
 		}
 	}
 
+	finishing.Lock()
+	interrupted := addInterruptCheck()
+	if maxErrors > 0 || maxErrorRate > 0 {
+		addCheck(errorThresholdCheck, true, "")
+	}
+	slosMet := checkSLOs(slos)
+	sendFinalStats(slosMet && !interrupted)
 	showStatus()
+	printAPFUsages(out)
+	printThrottling(out)
+	printWorkers(out)
+	printWatchers(out)
+	printBookmarks(out)
+	printListComparison(out)
+	printInformers()
+	writeReport(config)
+	if pushgatewayURL != "" {
+		pushMetrics()
+	}
+	if len(steps) > 0 {
+		printStep(len(steps) - 1)
+	}
+	if duration > 0 {
+		elapsed := time.Since(deadline.Add(-duration))
+		total := atomic.LoadInt64(&counterSuccess) + atomic.LoadInt64(&counterFailure) + atomic.LoadInt64(&counterOversized)
+		fmt.Fprintf(out, "ran %s, %d requests (%.1f requests/s)\n", elapsed.Round(time.Second), total, float64(total)/elapsed.Seconds())
+	}
+	if interrupted && cleanOnInterrupt {
+		cleanRun(config, *resourceType)
+	}
+	runPostRunHook(slosMet && !interrupted)
+	if interrupted || !slosMet {
+		os.Exit(1)
+	}
 }
 
-func showStatus() {
-	fmt.Printf("success: %d, failure: %d\n", counterSuccess, counterFailure)
+// parseStartAt parses -startAt as an RFC3339 time or as a delay from now.
+// An empty value starts right away.
+func parseStartAt(s string, now time.Time) (time.Time, error) {
+	if s == "" {
+		return now, nil
+	}
+	if t, err := time.Parse(time.RFC3339, s); err == nil {
+		return t, nil
+	}
+	d, err := time.ParseDuration(s)
+	if err != nil || d < 0 {
+		return time.Time{}, fmt.Errorf("invalid time or delay %q", s)
+	}
+	return now.Add(d), nil
 }
 
-func gen(config *rest.Config, resourceCount int, resourceType string) {
-	ctx := context.Background()
-	wg := sync.WaitGroup{}
-	count := int(resourceCount / concurrency)
-	for i := 0; i < concurrency; i++ {
-		wg.Add(1)
-		go func(prefix string) {
-			defer wg.Done()
-			clientset, err := kubernetes.NewForConfig(config)
-			if err != nil {
-				panic(err)
-			}
-			if resourceType == resourceTypeConfigMap {
-				generateConfigMaps(ctx, clientset, prefix, count)
-			} else {
-				generateEvents(ctx, clientset, prefix, count)
-			}
-		}(fmt.Sprintf("%s-%d", globalPrefix, i))
+// keepGoing tells a worker loop whether to issue its i-th request: until
+// deadline for duration-based runs, otherwise count times. Closed-loop
+// workers think before every request but the first.
+func keepGoing(i int, count int) bool {
+	if (duration == 0 && i >= count) || stopRequested() {
+		return false
 	}
-	wg.Wait()
+	if i > 0 && schedule == nil {
+		think()
+	}
+	return (duration == 0 || time.Now().Before(deadline)) && !stopRequested()
 }
 
-func cleanup(config *rest.Config, resourceType string) {
-	ctx := context.Background()
-	clientset, err := kubernetes.NewForConfig(config)
-	if err != nil {
-		panic(err)
+func think() {
+	d := thinkTime
+	if jitter > 0 {
+		d += time.Duration(rand.Int63n(int64(2*jitter))) - jitter
 	}
-	if resourceType == resourceTypeConfigMap {
-		cleanConfigMaps(ctx, clientset)
-	} else {
-		cleanEvents(ctx, clientset)
+	if d > 0 {
+		time.Sleep(d)
 	}
 }
 
-func list(config *rest.Config, resourceType string) {
+func showStatus() {
+	recordStatus()
+	fmt.Fprintf(out, "success: %d, failure: %d, oversized: %d, watch events: %d\n", counterSuccess, counterFailure, counterOversized, counterWatchEvents)
+	printErrorClasses(out)
+	printLatencies(out)
+}
+
+func gen(config *rest.Config, resourceCount int, resourceType string) error {
 	ctx := context.Background()
-	wg := sync.WaitGroup{}
-	for i := 0; i < concurrency; i++ {
-		wg.Add(1)
-		go func() {
-			defer wg.Done()
-			clientset, err := kubernetes.NewForConfig(config)
-			if err != nil {
-				panic(err)
-			}
-			if resourceType == resourceTypeConfigMap {
-				listConfigMaps(ctx, clientset)
-			} else {
-				listEvents(ctx, clientset)
-			}
-		}()
+	if resumePrefix != "" {
+		if err := listExistingNames(ctx, config, resourceType); err != nil {
+			return err
+		}
 	}
-	wg.Wait()
+	if checkpointFile != "" {
+		go checkpointPeriodically(resourceType)
+	}
+	if err := newBurner(config, resourceType, resourceCount, "").Create(ctx); err != nil {
+		return err
+	}
+	if checkpointFile != "" {
+		writeCheckpoint(resourceType, true)
+	}
+	return nil
 }
 
-func generateEvents(ctx context.Context, clientset *kubernetes.Clientset, namePrefix string, count int) {
-	client := clientset.CoreV1().Events(apiv1.NamespaceDefault)
-	spec := &apiv1.Event{
-		ObjectMeta: metav1.ObjectMeta{},
-		Reason:     "CPburnerTest",
-		Message:    testMsg,
+// newBurner configures the burner of 'create', 'list' and 'clean' actions
+// from the flags.
+func newBurner(config *rest.Config, resourceType string, resourceCount int, labelSelector string) burner.Burner {
+	if duration > 0 {
+		// the workers go on until the deadline
+		resourceCount = -1
 	}
-	for i := 0; i < count; i++ {
-		spec.ObjectMeta.Name = fmt.Sprintf("%s-%d", namePrefix, i)
-		_, err := client.Create(ctx, spec, metav1.CreateOptions{})
-		if err != nil {
-			atomic.AddInt64(&counterFailure, 1)
-		} else {
-			atomic.AddInt64(&counterSuccess, 1)
-		}
+	b, err := burner.New(burner.Options{
+		Config:                   config,
+		ResourceType:             resourceType,
+		Prefix:                   globalPrefix,
+		Concurrency:              concurrency,
+		Clientsets:               clientsets,
+		Count:                    resourceCount,
+		Namespaces:               targetNamespaces(),
+		ListLimit:                listLimit,
+		ListTimeoutSeconds:       timeout,
+		ListResourceVersion:      listResourceVersion,
+		ListResourceVersionMatch: metav1.ResourceVersionMatch(listResourceVersionMatch),
+		LabelSelector:            labelSelector,
+		FieldSelector:            fieldSelector,
+		CreateOptions:            createOptions(),
+		DeleteOptions:            deleteOptions(),
+		WriteTimeout:             writeTimeout,
+		WorkerConfig:             workerConfig,
+		Name:                     objectName,
+		NamespaceOf:              namespaceOf,
+		Meta:                     generatedMeta,
+		Payload:                  payload,
+		InvolvedObject:           involvedObject,
+		Skip:                     func(name string) bool { return existingNames[name] },
+		Created:                  recordCreated,
+		Deleted:                  recordDeleted,
+		Terminating:              recordTerminating,
+		Issue:                    issueUntil,
+		Observe:                  record,
+	})
+	if err != nil {
+		panic(err)
 	}
+	return b
 }
 
-func generateConfigMaps(ctx context.Context, clientset *kubernetes.Clientset, namePrefix string, count int) {
-	client := clientset.CoreV1().ConfigMaps(apiv1.NamespaceDefault)
-	spec := &apiv1.ConfigMap{
-		ObjectMeta: metav1.ObjectMeta{},
-		Data:       map[string]string{"CPburnerTest": testMsg},
+// listExistingNames fills existingNames with the objects of the run to
+// resume, so gen only creates the others.
+func listExistingNames(ctx context.Context, config *rest.Config, resourceType string) error {
+	clientset, err := kubernetes.NewForConfig(config)
+	if err != nil {
+		panic(err)
 	}
-	for i := 0; i < count; i++ {
-		spec.ObjectMeta.Name = fmt.Sprintf("%s-%d", namePrefix, i)
-		_, err := client.Create(ctx, spec, metav1.CreateOptions{})
-		if err != nil {
-			atomic.AddInt64(&counterFailure, 1)
-		} else {
-			atomic.AddInt64(&counterSuccess, 1)
-		}
+	names, err := listGeneratedNames(ctx, clientset, resourceType)
+	if err != nil {
+		return err
+	}
+	existingNames = map[string]bool{}
+	for _, name := range names {
+		existingNames[name] = true
 	}
+	fmt.Fprintf(out, "resuming run %s, %d objects exist already\n", resumePrefix, len(existingNames))
+	return nil
 }
 
-func cleanConfigMaps(ctx context.Context, clientset *kubernetes.Clientset) {
-	client := clientset.CoreV1().ConfigMaps(apiv1.NamespaceDefault)
-	continueString := ""
-	for {
-		cms, err := client.List(ctx, metav1.ListOptions{TimeoutSeconds: &timeout, Limit: listLimit, Continue: continueString})
-		if err != nil {
-			panic(err)
-		}
-		if len(cms.Items) == 0 {
-			return
-		}
-		for _, cm := range cms.Items {
-			if err := client.Delete(ctx, cm.Name, metav1.DeleteOptions{}); err != nil {
-				// fmt.Printf("failed to delete cm %s, error: %s\n", cm.Name, err.Error())
-				atomic.AddInt64(&counterFailure, 1)
-			} else {
-				atomic.AddInt64(&counterSuccess, 1)
-			}
-		}
-		continueString = cms.GetListMeta().GetContinue()
+// loadConfig connects to server directly if given. Otherwise it reads the
+// kubeconfig the way kubectl does, honoring $KUBECONFIG, falling back to the
+// in-cluster config when there is nothing to read.
+func loadConfig(kubeconfig string, context string, server string, token string) (*rest.Config, error) {
+	if server != "" {
+		return &rest.Config{Host: server, BearerToken: token}, nil
+	}
+	if kubeconfig == "" && context == "" && os.Getenv(clientcmd.RecommendedConfigPathEnvVar) == "" {
+		return rest.InClusterConfig()
 	}
+	rules := clientcmd.NewDefaultClientConfigLoadingRules()
+	rules.ExplicitPath = kubeconfig
+	overrides := &clientcmd.ConfigOverrides{CurrentContext: context}
+	return clientcmd.NewNonInteractiveDeferredLoadingClientConfig(rules, overrides).ClientConfig()
 }
 
-func cleanEvents(ctx context.Context, clientset *kubernetes.Clientset) {
-	client := clientset.CoreV1().Events(apiv1.NamespaceDefault)
-	continueString := ""
-	for {
-		events, err := client.List(ctx, metav1.ListOptions{TimeoutSeconds: &timeout, Limit: listLimit, Continue: continueString})
-		if err != nil {
-			panic(err)
-		}
-		if len(events.Items) == 0 {
-			return
-		}
-		for _, e := range events.Items {
-			if err := client.Delete(ctx, e.Name, metav1.DeleteOptions{}); err != nil {
-				atomic.AddInt64(&counterFailure, 1)
-			} else {
-				atomic.AddInt64(&counterSuccess, 1)
-			}
+// cleanup deletes the objects with -cleanStrategy, printing its progress
+// along the way. It reports what it deleted even if it could not finish,
+// the error tells why.
+func cleanup(config *rest.Config, resourceType string) error {
+	ctx := context.Background()
+	clientset, err := kubernetes.NewForConfig(config)
+	if err != nil {
+		panic(err)
+	}
+	start := time.Now()
+	done := make(chan struct{})
+	go printCleanProgress(start, done)
+	defer close(done)
+	var deleted int64
+	if filtersObjects() {
+		deleted, err = deleteFiltered(ctx, config, resourceType)
+	} else if cleanStrategy == cleanStrategyDeleteCollection {
+		deleted, err = deleteCollection(ctx, clientset, resourceType)
+	} else if cleanStrategy == cleanStrategyNamespace {
+		deleted, err = deleteNamespaces(ctx, clientset, resourceType)
+	} else {
+		// counted for the progress only, a failure leaves the ETA out
+		opts := metav1.ListOptions{TimeoutSeconds: &timeout, LabelSelector: runSelector(), FieldSelector: fieldSelector}
+		if total, _, err := countLiveObjects(ctx, clientset, resourceType, opts); err == nil {
+			atomic.StoreInt64(&cleanTotal, total)
 		}
-		continueString = events.GetListMeta().GetContinue()
+		err = newBurner(config, resourceType, 0, runSelector()).Clean(ctx)
+		deleted = atomic.LoadInt64(&cleanDeleted)
+	}
+	elapsed := time.Since(start)
+	fmt.Fprintf(out, "clean strategy '%s' deleted %d %s objects in %s (%.1f objects/s)\n",
+		cleanStrategy, deleted, resourceType, elapsed, float64(deleted)/elapsed.Seconds())
+	if terminating := atomic.LoadInt64(&cleanTerminating); terminating > 0 {
+		fmt.Fprintf(out, "%d %s objects are left terminating, run the 'finalize' action to release those held by %s\n",
+			terminating, resourceType, finalizerName)
 	}
+	return err
 }
 
-func listConfigMaps(ctx context.Context, clientset *kubernetes.Clientset) {
-	client := clientset.CoreV1().ConfigMaps(apiv1.NamespaceDefault)
-	continueString := ""
-	for {
-		resources, err := client.List(ctx, metav1.ListOptions{TimeoutSeconds: &timeout, Limit: listLimit, Continue: continueString})
-		if err != nil {
-			// fmt.Println("failed to list: ", err)
-			atomic.AddInt64(&counterFailure, 1)
-		} else {
-			atomic.AddInt64(&counterSuccess, 1)
-		}
-		if len(resources.Items) == 0 || resources.GetContinue() == "" {
-			return
-		}
-		continueString = resources.GetListMeta().GetContinue()
+// list pages through the objects once from every worker. Pages failing
+// transiently are retried, the error is the first of those that were not.
+func list(config *rest.Config, resourceType string) error {
+	ctx := context.Background()
+	if listMethod != listMethodChunked {
+		return listEachWorker(config, func(clientset *kubernetes.Clientset, ns string) error {
+			if listMethod == listMethodCompare {
+				return compareLists(ctx, clientset, resourceType, ns)
+			}
+			return recordedWatchList(ctx, clientset, ns, resourceName(resourceType))
+		})
+	}
+	if listDecode == listDecodeFull {
+		return newBurner(config, resourceType, 0, selector()).List(ctx)
 	}
+	resource := resourceName(resourceType)
+	return listEachWorker(config, func(clientset *kubernetes.Clientset, ns string) error {
+		return streamList(ctx, clientset, ns, resource)
+	})
 }
 
-func listEvents(ctx context.Context, clientset *kubernetes.Clientset) {
-	client := clientset.CoreV1().Events(apiv1.NamespaceDefault)
-	continueString := ""
-	for {
-		resources, err := client.List(ctx, metav1.ListOptions{TimeoutSeconds: &timeout, Limit: listLimit, Continue: continueString})
-		if err != nil {
-			atomic.AddInt64(&counterFailure, 1)
-		} else {
-			atomic.AddInt64(&counterSuccess, 1)
-		}
-		if len(resources.Items) == 0 || resources.GetContinue() == "" {
-			return
-		}
-		continueString = resources.GetListMeta().GetContinue()
+// listEachWorker calls listNamespace for every target namespace from every
+// worker, each with a clientset of its own. A worker stops at its first
+// error, the first of those is returned.
+func listEachWorker(config *rest.Config, listNamespace func(clientset *kubernetes.Clientset, ns string) error) error {
+	wg := sync.WaitGroup{}
+	errs := make(chan error, concurrency)
+	for i := 0; i < concurrency; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			clientset, err := kubernetes.NewForConfig(config)
+			if err != nil {
+				panic(err)
+			}
+			for _, ns := range targetNamespaces() {
+				if err := listNamespace(clientset, ns); err != nil {
+					errs <- err
+					return
+				}
+			}
+		}()
 	}
+	wg.Wait()
+	close(errs)
+	return <-errs
 }
 
 func randomString(n int) string {
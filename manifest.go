@@ -0,0 +1,122 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"os"
+
+	appsv1 "k8s.io/api/apps/v1"
+	batchv1 "k8s.io/api/batch/v1"
+	apiv1 "k8s.io/api/core/v1"
+	rbacv1 "k8s.io/api/rbac/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"sigs.k8s.io/yaml"
+)
+
+const (
+	actionManifest = "manifest"
+
+	manifestKindJob        = "job"
+	manifestKindDeployment = "deployment"
+)
+
+var (
+	manifestCommand   string
+	manifestKind      string
+	manifestImage     string
+	manifestNamespace string
+	manifestReplicas  int
+)
+
+var manifestFlags = []string{"manifestCommand", "manifestKind", "image", "manifestNamespace", "manifestReplicas"}
+
+// connectionFlags point at credentials outside the cluster, in-cluster the
+// pod connects through its ServiceAccount instead.
+var connectionFlags = map[string]bool{
+	"kubeconfig": true, "context": true, "server": true, "token": true, "caFile": true, "insecureSkipTLSVerify": true,
+}
+
+// printManifest prints the ServiceAccount, its ClusterRoleBinding and a Job
+// or Deployment running -manifestCommand with the other flags given, those
+// of a -config scenario included.
+func printManifest() {
+	cmd := lookupCommand(manifestCommand)
+	if cmd == nil || cmd.name == actionManifest {
+		usageError("-manifestCommand %q is not a command", manifestCommand)
+	}
+	if manifestKind != manifestKindJob && manifestKind != manifestKindDeployment {
+		usageError("-manifestKind must be %q or %q, not %q", manifestKindJob, manifestKindDeployment, manifestKind)
+	}
+	if manifestReplicas < 1 {
+		usageError("-manifestReplicas must be at least 1")
+	}
+	args := []string{"cpburner", cmd.name}
+	flag.Visit(func(f *flag.Flag) {
+		if f.Name == "action" || f.Name == "config" || connectionFlags[f.Name] || contains(manifestFlags, f.Name) {
+			return
+		}
+		if !cmd.accepts(f.Name) {
+			usageError("flag -%s does not apply to command %s", f.Name, cmd.name)
+		}
+		args = append(args, fmt.Sprintf("-%s=%s", f.Name, f.Value))
+	})
+
+	name := "cpburner-" + cmd.name
+	labels := map[string]string{"app": name}
+	pod := apiv1.PodTemplateSpec{
+		ObjectMeta: metav1.ObjectMeta{Labels: labels},
+		Spec: apiv1.PodSpec{
+			ServiceAccountName: "cpburner",
+			Containers:         []apiv1.Container{{Name: "cpburner", Image: manifestImage, Command: args}},
+		},
+	}
+	replicas := int32(manifestReplicas)
+	var workload interface{}
+	if manifestKind == manifestKindJob {
+		pod.Spec.RestartPolicy = apiv1.RestartPolicyNever
+		backoffLimit := int32(4)
+		workload = &batchv1.Job{
+			TypeMeta:   metav1.TypeMeta{APIVersion: "batch/v1", Kind: "Job"},
+			ObjectMeta: metav1.ObjectMeta{Name: name, Namespace: manifestNamespace, Labels: labels},
+			Spec:       batchv1.JobSpec{Parallelism: &replicas, Completions: &replicas, BackoffLimit: &backoffLimit, Template: pod},
+		}
+	} else {
+		workload = &appsv1.Deployment{
+			TypeMeta:   metav1.TypeMeta{APIVersion: "apps/v1", Kind: "Deployment"},
+			ObjectMeta: metav1.ObjectMeta{Name: name, Namespace: manifestNamespace, Labels: labels},
+			Spec:       appsv1.DeploymentSpec{Replicas: &replicas, Selector: &metav1.LabelSelector{MatchLabels: labels}, Template: pod},
+		}
+	}
+	objects := []interface{}{
+		&apiv1.ServiceAccount{
+			TypeMeta:   metav1.TypeMeta{APIVersion: "v1", Kind: "ServiceAccount"},
+			ObjectMeta: metav1.ObjectMeta{Name: "cpburner", Namespace: manifestNamespace},
+		},
+		&rbacv1.ClusterRoleBinding{
+			TypeMeta:   metav1.TypeMeta{APIVersion: "rbac.authorization.k8s.io/v1", Kind: "ClusterRoleBinding"},
+			ObjectMeta: metav1.ObjectMeta{Name: "cpburner-" + manifestNamespace},
+			RoleRef:    rbacv1.RoleRef{APIGroup: "rbac.authorization.k8s.io", Kind: "ClusterRole", Name: "cluster-admin"},
+			Subjects:   []rbacv1.Subject{{Kind: rbacv1.ServiceAccountKind, Name: "cpburner", Namespace: manifestNamespace}},
+		},
+		workload,
+	}
+	for i, obj := range objects {
+		data, err := yaml.Marshal(obj)
+		if err != nil {
+			panic(err)
+		}
+		if i > 0 {
+			fmt.Fprintln(os.Stdout, "---")
+		}
+		os.Stdout.Write(data)
+	}
+}
+
+func contains(list []string, s string) bool {
+	for _, e := range list {
+		if e == s {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,119 @@
+package main
+
+import (
+	"fmt"
+	"net/http"
+	"net/http/pprof"
+	"strconv"
+	"sync/atomic"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/promhttp"
+	"github.com/prometheus/client_golang/prometheus/push"
+)
+
+var (
+	requestsMetric = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Name: "cpburner_requests_total",
+		Help: "Requests cpburner issued, by verb, resource and HTTP code.",
+	}, []string{"verb", "resource", "code"})
+	requestDurationMetric = prometheus.NewHistogramVec(prometheus.HistogramOpts{
+		Name:    "cpburner_request_duration_seconds",
+		Help:    "Latency of the requests cpburner issued, by verb, resource and HTTP code.",
+		Buckets: prometheus.ExponentialBuckets(0.001, 2, 17),
+	}, []string{"verb", "resource", "code"})
+	inflightMetric = prometheus.NewGaugeVec(prometheus.GaugeOpts{
+		Name: "cpburner_inflight_requests",
+		Help: "Requests outstanding right now, by HTTP method, watches included.",
+	}, []string{"method"})
+	watchEventsMetric = prometheus.NewCounter(prometheus.CounterOpts{
+		Name: "cpburner_watch_events_total",
+		Help: "Events received by watches, excluding bookmarks.",
+	})
+)
+
+func init() {
+	prometheus.MustRegister(requestsMetric, requestDurationMetric, inflightMetric, watchEventsMetric)
+}
+
+// serveMetrics exposes the metrics on metricsAddr for the rest of the run.
+func serveMetrics() {
+	mux := http.NewServeMux()
+	mux.Handle("/metrics", promhttp.Handler())
+	go func() {
+		panic(http.ListenAndServe(metricsAddr, mux))
+	}()
+}
+
+// pushMetrics pushes the metrics to pushgatewayURL, grouped by the run
+// prefix so concurrent runs do not overwrite each other.
+func pushMetrics() {
+	err := push.New(pushgatewayURL, "cpburner").Grouping("run", globalPrefix).Gatherer(prometheus.DefaultGatherer).Push()
+	if err != nil {
+		fmt.Fprintf(out, "failed to push metrics: %s\n", err)
+	}
+}
+
+// pushMetricsPeriodically pushes the metrics every pushInterval for the
+// rest of the run, main pushes them a last time at the end.
+func pushMetricsPeriodically() {
+	for {
+		time.Sleep(pushInterval)
+		pushMetrics()
+	}
+}
+
+// servePprof exposes net/http/pprof on pprofAddr for profiling cpburner
+// itself.
+func servePprof() {
+	mux := http.NewServeMux()
+	mux.HandleFunc("/debug/pprof/", pprof.Index)
+	mux.HandleFunc("/debug/pprof/cmdline", pprof.Cmdline)
+	mux.HandleFunc("/debug/pprof/profile", pprof.Profile)
+	mux.HandleFunc("/debug/pprof/symbol", pprof.Symbol)
+	mux.HandleFunc("/debug/pprof/trace", pprof.Trace)
+	go func() {
+		panic(http.ListenAndServe(pprofAddr, mux))
+	}()
+}
+
+// codeLabel is the HTTP code of a finished request as reported in metrics
+// and the error breakdown.
+func codeLabel(code int32, err error) string {
+	if code > 0 {
+		return strconv.Itoa(int(code))
+	} else if err != nil {
+		return "error"
+	}
+	return "2xx"
+}
+
+func observeRequestMetric(verb string, resource string, code int32, err error, d time.Duration) {
+	label := codeLabel(code, err)
+	requestsMetric.WithLabelValues(verb, resource, label).Inc()
+	requestDurationMetric.WithLabelValues(verb, resource, label).Observe(d.Seconds())
+}
+
+// inflightTracker keeps cpburner_inflight_requests and counterInflight up
+// to date for every client built from the config it wraps.
+type inflightTracker struct {
+	next http.RoundTripper
+}
+
+func (t *inflightTracker) RoundTrip(req *http.Request) (*http.Response, error) {
+	gauge := inflightMetric.WithLabelValues(req.Method)
+	gauge.Inc()
+	atomic.AddInt64(&counterInflight, 1)
+	done := func() {
+		gauge.Dec()
+		atomic.AddInt64(&counterInflight, -1)
+	}
+	resp, err := t.next.RoundTrip(req)
+	if err != nil {
+		done()
+		return nil, err
+	}
+	resp.Body = &releasingBody{ReadCloser: resp.Body, release: done}
+	return resp, nil
+}
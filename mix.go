@@ -0,0 +1,214 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"math/rand"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"cpburner/pkg/burner"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/client-go/kubernetes"
+	"k8s.io/client-go/rest"
+)
+
+type verbWeight struct {
+	verb   string
+	weight int
+}
+
+type verbCounter struct {
+	success int64
+	failure int64
+}
+
+// parseMix parses a verb mix like "create=50,get=30,list=10,update=10".
+func parseMix(s string) ([]verbWeight, error) {
+	mix := []verbWeight{}
+	total := 0
+	for _, part := range strings.Split(s, ",") {
+		kv := strings.SplitN(strings.TrimSpace(part), "=", 2)
+		if len(kv) != 2 {
+			return nil, fmt.Errorf("expected verb=weight, got %q", part)
+		}
+		switch kv[0] {
+		case verbCreate, verbGet, verbList, verbUpdate, verbDelete:
+		default:
+			return nil, fmt.Errorf("unknown verb %q", kv[0])
+		}
+		weight, err := strconv.Atoi(kv[1])
+		if err != nil || weight < 0 {
+			return nil, fmt.Errorf("invalid weight %q for verb %s", kv[1], kv[0])
+		}
+		mix = append(mix, verbWeight{verb: kv[0], weight: weight})
+		total += weight
+	}
+	if total == 0 {
+		return nil, fmt.Errorf("at least one verb needs a positive weight")
+	}
+	return mix, nil
+}
+
+func pickVerb(mix []verbWeight, total int) string {
+	n := rand.Intn(total)
+	for _, vw := range mix {
+		if n < vw.weight {
+			return vw.verb
+		}
+		n -= vw.weight
+	}
+	return mix[len(mix)-1].verb
+}
+
+// mixedLoad issues resourceCount requests in total, picking the verb of every
+// request according to the weights in mix. Reads, updates and deletes target
+// objects the same worker created earlier; until a worker has created one it
+// creates instead.
+func mixedLoad(config *rest.Config, resourceCount int, resourceType string, mix []verbWeight) {
+	ctx := context.Background()
+	total := 0
+	counters := map[string]*verbCounter{}
+	for _, vw := range mix {
+		total += vw.weight
+		counters[vw.verb] = &verbCounter{}
+	}
+	if counters[verbCreate] == nil {
+		counters[verbCreate] = &verbCounter{}
+	}
+	wg := sync.WaitGroup{}
+	count := int(resourceCount / concurrency)
+	for i := 0; i < concurrency; i++ {
+		wg.Add(1)
+		go func(prefix string) {
+			defer wg.Done()
+			clientset, err := kubernetes.NewForConfig(workerConfig(config))
+			if err != nil {
+				panic(err)
+			}
+			c := &objectClient{clientset: clientset, resourceType: resourceType}
+			names := []string{}
+			for j := 0; keepGoing(j, count); j++ {
+				verb := pickVerb(mix, total)
+				if len(names) == 0 && verb != verbList {
+					verb = verbCreate
+				}
+				var err error
+				switch verb {
+				case verbCreate:
+					name := objectName(prefix, j)
+					if err = c.create(ctx, name); err == nil {
+						names = append(names, name)
+					}
+				case verbGet:
+					err = c.get(ctx, names[rand.Intn(len(names))])
+				case verbList:
+					err = c.list(ctx)
+				case verbUpdate:
+					err = c.update(ctx, names[rand.Intn(len(names))])
+				case verbDelete:
+					k := rand.Intn(len(names))
+					if err = c.delete(ctx, names[k]); err == nil {
+						names[k] = names[len(names)-1]
+						names = names[:len(names)-1]
+					}
+				}
+				if warmingUp() {
+					continue
+				} else if err != nil {
+					atomic.AddInt64(&counters[verb].failure, 1)
+				} else {
+					atomic.AddInt64(&counters[verb].success, 1)
+				}
+			}
+		}(fmt.Sprintf("%s-%d", globalPrefix, i))
+	}
+	wg.Wait()
+
+	verbs := []string{}
+	for verb := range counters {
+		verbs = append(verbs, verb)
+	}
+	sort.Strings(verbs)
+	for _, verb := range verbs {
+		fmt.Fprintf(out, "%s: success: %d, failure: %d\n", verb, counters[verb].success, counters[verb].failure)
+	}
+}
+
+// objectClient issues single requests of any verb against one resource type
+// and records each of them.
+type objectClient struct {
+	clientset    *kubernetes.Clientset
+	resourceType string
+}
+
+func (c *objectClient) create(ctx context.Context, name string) (err error) {
+	start := time.Now()
+	defer func() { record(verbCreate, resourceName(c.resourceType), start, err) }()
+	ctx, cancel := writeContext(ctx)
+	defer cancel()
+	meta := generatedMeta(name)
+	meta.Namespace = namespaceOf(name)
+	return burner.Generator(c.resourceType).Create(ctx, c.clientset, burner.Object{Meta: meta, Payload: payload(name), InvolvedObject: involvedObject(name)}, createOptions())
+}
+
+func (c *objectClient) get(ctx context.Context, name string) (err error) {
+	start := time.Now()
+	defer func() { record(verbGet, resourceName(c.resourceType), start, err) }()
+	_, err = burner.Generator(c.resourceType).Get(ctx, c.clientset, namespaceOf(name), name, metav1.GetOptions{})
+	return err
+}
+
+func (c *objectClient) list(ctx context.Context) (err error) {
+	start := time.Now()
+	defer func() { record(verbList, resourceName(c.resourceType), start, err) }()
+	opts := metav1.ListOptions{TimeoutSeconds: &timeout, Limit: listLimit}
+	_, _, err = burner.Generator(c.resourceType).List(ctx, c.clientset, namespaceAt(rand.Intn(namespaceCount())), opts)
+	return err
+}
+
+// update overwrites the object unconditionally with a fresh annotation so
+// every update is a real write.
+func (c *objectClient) update(ctx context.Context, name string) (err error) {
+	start := time.Now()
+	defer func() { record(verbUpdate, resourceName(c.resourceType), start, err) }()
+	ctx, cancel := writeContext(ctx)
+	defer cancel()
+	meta := generatedMeta(name)
+	metav1.SetMetaDataAnnotation(&meta, "cpburner/updated", time.Now().Format(time.RFC3339Nano))
+	meta.Namespace = namespaceOf(name)
+	return burner.Generator(c.resourceType).Update(ctx, c.clientset, burner.Object{Meta: meta, Payload: payload(name), InvolvedObject: involvedObject(name)}, updateOptions())
+}
+
+func (c *objectClient) delete(ctx context.Context, name string) (err error) {
+	start := time.Now()
+	defer func() { record(verbDelete, resourceName(c.resourceType), start, err) }()
+	ctx, cancel := writeContext(ctx)
+	defer cancel()
+	return burner.Generator(c.resourceType).Delete(ctx, c.clientset, namespaceOf(name), name, deleteOptions())
+}
+
+// touch reads the object and writes it back with a fresh annotation,
+// conditional on the resourceVersion it read, so that concurrent touches of
+// the same object conflict. It returns the error of the update.
+func (c *objectClient) touch(ctx context.Context, name string) error {
+	resource := resourceName(c.resourceType)
+	generator := burner.Generator(c.resourceType)
+	start := time.Now()
+	obj, err := generator.Get(ctx, c.clientset, namespaceOf(name), name, metav1.GetOptions{})
+	record(verbGet, resource, start, err)
+	if err != nil {
+		return err
+	}
+	metav1.SetMetaDataAnnotation(&obj.Meta, "cpburner/updated", time.Now().Format(time.RFC3339Nano))
+	start = time.Now()
+	wctx, cancel := writeContext(ctx)
+	err = generator.Update(wctx, c.clientset, obj, updateOptions())
+	cancel()
+	record(verbUpdate, resource, start, err)
+	return err
+}
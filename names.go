@@ -0,0 +1,69 @@
+package main
+
+import (
+	"fmt"
+	"hash/fnv"
+)
+
+const (
+	nameStrategySequential = "sequential"
+	nameStrategyUUID       = "uuid"
+	nameStrategyHashed     = "hashed"
+	nameStrategyRealistic  = "realistic"
+
+	// the alphabet Kubernetes uses for generated name suffixes
+	nameSuffixAlphabet = "bcdfghjklmnpqrstvwxz2456789"
+	// how many realistic names share one deployment and replicaset hash
+	podsPerDeployment = 10
+)
+
+var deploymentWords = []string{
+	"frontend", "backend", "api-gateway", "auth", "billing", "cart", "catalog", "checkout",
+	"inventory", "metrics-collector", "notification", "orders", "payments", "search", "worker",
+}
+
+// objectName returns the name of the i-th object a worker with the given
+// prefix creates. All strategies keep the prefix so that generated objects
+// can still be recognized by isGenerated.
+func objectName(prefix string, i int) string {
+	switch nameStrategy {
+	case nameStrategyUUID:
+		// random version 4 UUIDs, reproducible with -seed
+		seeded := fmt.Sprintf("%s-%d", prefix, seed)
+		a, b := nameHash(seeded, 2*i), nameHash(seeded, 2*i+1)
+		return fmt.Sprintf("%s-%08x-%04x-%04x-%04x-%012x", prefix,
+			a>>32, a>>16&0xffff, 0x4000|a&0xfff, 0x8000|b>>48&0x3fff, b&(1<<48-1))
+	case nameStrategyHashed:
+		return fmt.Sprintf("%s-%016x", prefix, nameHash(prefix, i))
+	case nameStrategyRealistic:
+		d := i / podsPerDeployment
+		deployment := deploymentWords[d%len(deploymentWords)]
+		if n := d / len(deploymentWords); n > 0 {
+			deployment = fmt.Sprintf("%s-%d", deployment, n)
+		}
+		return fmt.Sprintf("%s-%s-%s-%s", prefix, deployment,
+			encodeSuffix(nameHash(prefix+"-"+deployment, 0), 10), encodeSuffix(nameHash(prefix, i), 5))
+	default:
+		return fmt.Sprintf("%s-%d", prefix, i)
+	}
+}
+
+func nameHash(prefix string, i int) uint64 {
+	h := fnv.New64a()
+	fmt.Fprintf(h, "%s-%d", prefix, i)
+	// splitmix64 finalizer, FNV alone barely changes the high bits for
+	// consecutive i
+	x := h.Sum64()
+	x = (x ^ (x >> 30)) * 0xbf58476d1ce4e5b9
+	x = (x ^ (x >> 27)) * 0x94d049bb133111eb
+	return x ^ (x >> 31)
+}
+
+func encodeSuffix(h uint64, n int) string {
+	b := make([]byte, n)
+	for i := range b {
+		b[i] = nameSuffixAlphabet[h%uint64(len(nameSuffixAlphabet))]
+		h /= uint64(len(nameSuffixAlphabet))
+	}
+	return string(b)
+}
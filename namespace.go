@@ -0,0 +1,176 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"strings"
+	"sync/atomic"
+	"time"
+
+	"cpburner/pkg/burner"
+	apiv1 "k8s.io/api/core/v1"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/client-go/kubernetes"
+)
+
+// namespaceCount is how many namespaces objects are spread over.
+func namespaceCount() int {
+	if namespaces == 0 {
+		return 1
+	}
+	return namespaces
+}
+
+// namespaceAt is the i-th of the namespaces objects are spread over,
+// -namespace unless -namespaces is set.
+func namespaceAt(i int) string {
+	if namespaces == 0 {
+		return namespace
+	}
+	return fmt.Sprintf("%s%d", namespacePrefix, i%namespaces)
+}
+
+// clusterNamespaces replaces the target namespaces of a 'clean' run by
+// every namespace of the cluster, with -allNamespaces
+var clusterNamespaces []string
+
+func targetNamespaces() []string {
+	if clusterNamespaces != nil {
+		return clusterNamespaces
+	}
+	result := []string{}
+	for i := 0; i < namespaceCount(); i++ {
+		result = append(result, namespaceAt(i))
+	}
+	return result
+}
+
+// namespaceOf is the namespace of the object name. It hashes the name, so
+// later runs find the objects of earlier ones given the same -namespaces.
+func namespaceOf(name string) string {
+	return namespaceAt(int(nameHash(name, 0) % uint64(namespaceCount())))
+}
+
+// how long the 'namespace' clean strategy waits for the namespace controller
+// to remove the namespaces it deleted
+const namespaceDeleteTimeout = 10 * time.Minute
+
+// ensureNamespace creates the namespace name with labels unless it exists.
+// It is run setup, so the request is not recorded. Target namespaces get the
+// labels of the objects, not their finalizer or annotations, which would
+// hold them up or expire them.
+func ensureNamespace(ctx context.Context, clientset *kubernetes.Clientset, name string, labels map[string]string) error {
+	ns := &apiv1.Namespace{ObjectMeta: metav1.ObjectMeta{Name: name, Labels: labels}}
+	_, err := clientset.CoreV1().Namespaces().Create(ctx, ns, metav1.CreateOptions{})
+	if apierrors.IsAlreadyExists(err) {
+		return nil
+	}
+	return err
+}
+
+// useClusterNamespaces makes the namespaces of the cluster the target
+// namespaces, those cpburner created only for the 'namespace' clean strategy
+// as it deletes them whole. Like ensureNamespace it is run setup, the
+// requests are not recorded.
+func useClusterNamespaces(ctx context.Context, clientset *kubernetes.Clientset) error {
+	opts := metav1.ListOptions{TimeoutSeconds: &timeout, Limit: listLimit}
+	if cleanStrategy == cleanStrategyNamespace {
+		opts.LabelSelector = runLabel
+	}
+	result := []string{}
+	for {
+		var list *apiv1.NamespaceList
+		err := burner.Retry(ctx, func() (err error) {
+			list, err = clientset.CoreV1().Namespaces().List(ctx, opts)
+			return err
+		})
+		if err != nil {
+			return fmt.Errorf("listing namespaces: %w", err)
+		}
+		for _, ns := range list.Items {
+			if cleanStrategy == cleanStrategyNamespace && systemNamespace(ns.Name) {
+				continue
+			}
+			result = append(result, ns.Name)
+		}
+		if list.Continue == "" {
+			break
+		}
+		opts.Continue = list.Continue
+	}
+	clusterNamespaces = result
+	fmt.Fprintf(out, "going through the %d namespaces of the cluster\n", len(result))
+	return nil
+}
+
+// systemNamespace tells whether the 'namespace' clean strategy must not
+// delete name: the namespaces of the cluster itself and those holding the
+// stored reports and the leader Lease, even if a run labelled them.
+func systemNamespace(name string) bool {
+	if name == resultsNamespace || (leaseName != "" && name == leaseNamespace) {
+		return true
+	}
+	return name == apiv1.NamespaceDefault || strings.HasPrefix(name, "kube-")
+}
+
+// deleteNamespaces deletes the target namespaces cpburner created with
+// everything in them and waits until the namespace controller finished, for
+// namespaceDeleteTimeout at most. It returns how many resourceType objects
+// went with them.
+func deleteNamespaces(ctx context.Context, clientset *kubernetes.Clientset, resourceType string) (int64, error) {
+	var count int64
+	owned := []string{}
+	// objects of every owned namespace, deleted once it is gone
+	counts := map[string]int64{}
+	for _, ns := range targetNamespaces() {
+		existing, err := clientset.CoreV1().Namespaces().Get(ctx, ns, metav1.GetOptions{})
+		if apierrors.IsNotFound(err) {
+			continue
+		} else if err != nil {
+			return 0, fmt.Errorf("getting namespace %s: %w", ns, err)
+		}
+		if systemNamespace(ns) {
+			fmt.Fprintf(out, "skipping namespace %s, cpburner does not delete it\n", ns)
+			continue
+		}
+		if existing.Labels[runLabel] == "" {
+			fmt.Fprintf(out, "skipping namespace %s, it has no %s label so cpburner did not create it\n", ns, runLabel)
+			continue
+		}
+		n, err := countObjectsIn(ctx, clientset, resourceType, ns, metav1.ListOptions{TimeoutSeconds: &timeout})
+		if err != nil {
+			return 0, err
+		}
+		count += n
+		counts[ns] = n
+		owned = append(owned, ns)
+	}
+	atomic.StoreInt64(&cleanTotal, count)
+	for _, ns := range owned {
+		err := burner.Retry(ctx, func() error {
+			start := time.Now()
+			err := clientset.CoreV1().Namespaces().Delete(ctx, ns, metav1.DeleteOptions{})
+			record(verbDelete, "namespaces", start, err)
+			return err
+		})
+		if err != nil && !apierrors.IsNotFound(err) {
+			return 0, fmt.Errorf("deleting namespace %s: %w", ns, err)
+		}
+	}
+	deadline := time.Now().Add(namespaceDeleteTimeout)
+	for _, ns := range owned {
+		for {
+			_, err := clientset.CoreV1().Namespaces().Get(ctx, ns, metav1.GetOptions{})
+			if apierrors.IsNotFound(err) {
+				atomic.AddInt64(&cleanDeleted, counts[ns])
+				break
+			}
+			if time.Now().After(deadline) {
+				return atomic.LoadInt64(&cleanDeleted), fmt.Errorf("namespace %s is still terminating after %s", ns, namespaceDeleteTimeout)
+			}
+			time.Sleep(time.Second)
+		}
+	}
+	return count, nil
+}
@@ -0,0 +1,262 @@
+package main
+
+import (
+	"bufio"
+	"context"
+	"encoding/json"
+	"flag"
+	"fmt"
+	"io"
+	"os"
+	"os/exec"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"k8s.io/apimachinery/pkg/runtime/schema"
+	"k8s.io/apimachinery/pkg/types"
+	"k8s.io/apimachinery/pkg/watch"
+	"k8s.io/client-go/dynamic"
+	"k8s.io/client-go/rest"
+)
+
+const (
+	actionOperator = "operator"
+
+	runPhasePending   = "Pending"
+	runPhaseRunning   = "Running"
+	runPhaseSucceeded = "Succeeded"
+	runPhaseFailed    = "Failed"
+)
+
+// CpBurnerRuns, defined by manifest/crd_cpburnerrun.yaml, describe a run as
+// a command and its flags.
+var cpBurnerRunResource = schema.GroupVersionResource{Group: "cpburner.io", Version: "v1alpha1", Resource: "cpburnerruns"}
+
+// namespace of the CpBurnerRuns the operator runs, all if empty
+var operatorNamespace string
+
+// operator runs CpBurnerRuns one after the other in the order they are
+// created, every one as a child process so that runs do not share state.
+type operator struct {
+	client dynamic.NamespaceableResourceInterface
+	queue  chan *unstructured.Unstructured
+
+	mu sync.Mutex
+	// runs queued by this operator, by namespace/name
+	queued map[string]bool
+	// cancels the child of a running CpBurnerRun, by namespace/name
+	running map[string]context.CancelFunc
+}
+
+// runOperator watches the CpBurnerRuns of -operatorNamespace and runs those
+// that have not run yet, until killed. Runs an earlier operator left
+// running are marked as failed.
+func runOperator(config *rest.Config) {
+	ctx := context.Background()
+	client, err := dynamic.NewForConfig(config)
+	if err != nil {
+		panic(err)
+	}
+	o := &operator{client: client.Resource(cpBurnerRunResource), queue: make(chan *unstructured.Unstructured, 1000), queued: map[string]bool{}, running: map[string]context.CancelFunc{}}
+	go o.work(ctx)
+	fmt.Fprintf(out, "operator watching CpBurnerRuns in %s\n", namespaceDescription(operatorNamespace))
+	for {
+		list, err := o.client.Namespace(operatorNamespace).List(ctx, metav1.ListOptions{})
+		if err != nil {
+			fmt.Fprintf(out, "failed to list CpBurnerRuns: %s\n", err)
+			time.Sleep(10 * time.Second)
+			continue
+		}
+		sort.Slice(list.Items, func(i, j int) bool {
+			ti, tj := list.Items[i].GetCreationTimestamp(), list.Items[j].GetCreationTimestamp()
+			return ti.Before(&tj)
+		})
+		for i := range list.Items {
+			o.observe(ctx, watch.Added, &list.Items[i])
+		}
+		w, err := o.client.Namespace(operatorNamespace).Watch(ctx, metav1.ListOptions{ResourceVersion: list.GetResourceVersion(), AllowWatchBookmarks: true})
+		if err != nil {
+			fmt.Fprintf(out, "failed to watch CpBurnerRuns: %s\n", err)
+			continue
+		}
+		for event := range w.ResultChan() {
+			if run, ok := event.Object.(*unstructured.Unstructured); ok {
+				o.observe(ctx, event.Type, run)
+			}
+		}
+	}
+}
+
+func namespaceDescription(ns string) string {
+	if ns == "" {
+		return "all namespaces"
+	}
+	return "namespace " + ns
+}
+
+func runKey(run *unstructured.Unstructured) string {
+	return run.GetNamespace() + "/" + run.GetName()
+}
+
+// observe queues new runs, and pending ones an earlier operator left, and
+// stops deleted ones. A relist after a broken watch sees the runs queued
+// before again, they are not queued twice.
+func (o *operator) observe(ctx context.Context, t watch.EventType, run *unstructured.Unstructured) {
+	phase, _, _ := unstructured.NestedString(run.Object, "status", "phase")
+	switch t {
+	case watch.Added:
+		o.mu.Lock()
+		_, running := o.running[runKey(run)]
+		queued := o.queued[runKey(run)]
+		o.queued[runKey(run)] = true
+		o.mu.Unlock()
+		if phase == runPhaseRunning && !running {
+			o.finish(ctx, run, runPhaseFailed, "the operator running it restarted")
+		} else if (phase == "" || phase == runPhasePending) && !queued {
+			o.setStatus(ctx, run, map[string]interface{}{"phase": runPhasePending})
+			o.queue <- run
+		}
+	case watch.Deleted:
+		o.mu.Lock()
+		if cancel, ok := o.running[runKey(run)]; ok {
+			cancel()
+		}
+		delete(o.queued, runKey(run))
+		o.mu.Unlock()
+	}
+}
+
+func (o *operator) work(ctx context.Context) {
+	for run := range o.queue {
+		// skip runs deleted while they were queued
+		if _, err := o.client.Namespace(run.GetNamespace()).Get(ctx, run.GetName(), metav1.GetOptions{}); err != nil {
+			fmt.Fprintf(out, "skipping CpBurnerRun %s: %s\n", runKey(run), err)
+			continue
+		}
+		o.run(ctx, run)
+	}
+}
+
+// run executes a CpBurnerRun as 'cpburner <command> -<flag>=<value>...',
+// with the connection flags of the operator passed on through the
+// environment, and keeps its status up to date from the NDJSON status
+// records of the child.
+func (o *operator) run(ctx context.Context, run *unstructured.Unstructured) {
+	command, _, _ := unstructured.NestedString(run.Object, "spec", "command")
+	flags, _, _ := unstructured.NestedStringMap(run.Object, "spec", "flags")
+	cmd := lookupCommand(command)
+	if cmd == nil || cmd.name == actionOperator || cmd.name == actionManifest {
+		o.finish(ctx, run, runPhaseFailed, fmt.Sprintf("unknown command %q", command))
+		return
+	}
+	args := []string{cmd.name, "-outputStream", outputStreamStatus}
+	for name, value := range flags {
+		if name == "outputStream" || connectionFlags[name] {
+			o.finish(ctx, run, runPhaseFailed, fmt.Sprintf("flag %s is set by the operator", name))
+			return
+		}
+		args = append(args, fmt.Sprintf("-%s=%s", name, value))
+	}
+	executable, err := os.Executable()
+	if err != nil {
+		panic(err)
+	}
+	runCtx, cancel := context.WithCancel(ctx)
+	defer cancel()
+	child := exec.CommandContext(runCtx, executable, args...)
+	child.Env = os.Environ()
+	flag.Visit(func(f *flag.Flag) {
+		if connectionFlags[f.Name] || f.Name == "as" || f.Name == "asGroup" {
+			child.Env = append(child.Env, envName(f.Name)+"="+f.Value.String())
+		}
+	})
+	stdout, err := child.StdoutPipe()
+	if err != nil {
+		panic(err)
+	}
+	stderr, err := child.StderrPipe()
+	if err != nil {
+		panic(err)
+	}
+	if err := child.Start(); err != nil {
+		o.finish(ctx, run, runPhaseFailed, err.Error())
+		return
+	}
+	o.mu.Lock()
+	o.running[runKey(run)] = cancel
+	o.mu.Unlock()
+	defer func() {
+		o.mu.Lock()
+		delete(o.running, runKey(run))
+		o.mu.Unlock()
+	}()
+	fmt.Fprintf(out, "running CpBurnerRun %s: cpburner %s\n", runKey(run), strings.Join(args, " "))
+	o.setStatus(ctx, run, map[string]interface{}{"phase": runPhaseRunning, "startTime": time.Now().UTC().Format(time.RFC3339)})
+
+	wg := sync.WaitGroup{}
+	wg.Add(2)
+	go func() {
+		defer wg.Done()
+		o.followStatus(ctx, run, stdout)
+	}()
+	go func() {
+		defer wg.Done()
+		o.followOutput(ctx, run, stderr)
+	}()
+	wg.Wait()
+	if err := child.Wait(); err != nil {
+		if runCtx.Err() != nil {
+			err = fmt.Errorf("stopped, the CpBurnerRun was deleted")
+		}
+		o.finish(ctx, run, runPhaseFailed, err.Error())
+		return
+	}
+	o.finish(ctx, run, runPhaseSucceeded, "")
+}
+
+// followStatus copies the counters of every status record the child emits
+// to the status of run.
+func (o *operator) followStatus(ctx context.Context, run *unstructured.Unstructured, r io.Reader) {
+	scanner := bufio.NewScanner(r)
+	for scanner.Scan() {
+		s := statusRecord{}
+		if err := json.Unmarshal(scanner.Bytes(), &s); err != nil {
+			continue
+		}
+		o.setStatus(ctx, run, map[string]interface{}{"elapsed": s.Elapsed, "success": s.Success, "failure": s.Failure, "oversized": s.Oversized})
+	}
+}
+
+// followOutput passes the human readable output of the child on, prefixed
+// with the run, and records its run prefix.
+func (o *operator) followOutput(ctx context.Context, run *unstructured.Unstructured, r io.Reader) {
+	scanner := bufio.NewScanner(r)
+	for scanner.Scan() {
+		line := scanner.Text()
+		fmt.Fprintf(out, "%s: %s\n", runKey(run), line)
+		if strings.HasPrefix(line, "run prefix: ") {
+			o.setStatus(ctx, run, map[string]interface{}{"runPrefix": strings.TrimPrefix(line, "run prefix: ")})
+		}
+	}
+}
+
+func (o *operator) finish(ctx context.Context, run *unstructured.Unstructured, phase string, message string) {
+	fmt.Fprintf(out, "CpBurnerRun %s %s %s\n", runKey(run), strings.ToLower(phase), message)
+	o.setStatus(ctx, run, map[string]interface{}{"phase": phase, "message": message, "completionTime": time.Now().UTC().Format(time.RFC3339)})
+}
+
+// setStatus merges status into the status of run.
+func (o *operator) setStatus(ctx context.Context, run *unstructured.Unstructured, status map[string]interface{}) {
+	patch, err := json.Marshal(map[string]interface{}{"status": status})
+	if err != nil {
+		panic(err)
+	}
+	_, err = o.client.Namespace(run.GetNamespace()).Patch(ctx, run.GetName(), types.MergePatchType, patch, metav1.PatchOptions{}, "status")
+	if err != nil {
+		fmt.Fprintf(out, "failed to update the status of CpBurnerRun %s: %s\n", runKey(run), err)
+	}
+}
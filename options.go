@@ -0,0 +1,157 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"strings"
+
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/util/validation"
+)
+
+const (
+	dryRunNone   = "none"
+	dryRunServer = "server"
+	// 'clean' only: count what would be deleted, sending no deletes
+	dryRunClient = "client"
+
+	contentTypeJSON     = "json"
+	contentTypeProtobuf = "protobuf"
+)
+
+// The options below are used by every request that writes generated
+// objects, so that write-path flags apply to all actions alike.
+
+// runLabel carries the run prefix on every generated object, so that later
+// runs can select the objects of one run with -runPrefix.
+const runLabel = "cpburner/run"
+
+// labels and annotations of every generated object, from -labels and
+// -annotations
+var objectLabels, objectAnnotations map[string]string
+
+// parseKeyValues parses a list like "team=perf,run=abc".
+func parseKeyValues(s string) (map[string]string, error) {
+	if s == "" {
+		return nil, nil
+	}
+	result := map[string]string{}
+	for _, part := range strings.Split(s, ",") {
+		k, v, ok := strings.Cut(strings.TrimSpace(part), "=")
+		if !ok || validation.IsQualifiedName(k) != nil {
+			return nil, fmt.Errorf("invalid key %q", part)
+		}
+		result[k] = v
+	}
+	return result, nil
+}
+
+func parseLabels(s string) (map[string]string, error) {
+	result, err := parseKeyValues(s)
+	for k, v := range result {
+		if errs := validation.IsValidLabelValue(v); len(errs) > 0 {
+			return nil, fmt.Errorf("invalid value of label %s: %s", k, strings.Join(errs, ", "))
+		}
+	}
+	return result, err
+}
+
+// generatedMeta is the metadata of the generated object name.
+func generatedMeta(name string) metav1.ObjectMeta {
+	meta := metav1.ObjectMeta{Name: name, Labels: generatedLabels(), Finalizers: generatedFinalizers()}
+	for k, v := range generatedAnnotations() {
+		metav1.SetMetaDataAnnotation(&meta, k, v)
+	}
+	return meta
+}
+
+// generatedAnnotations are -annotations and, with -ttl, the expiry of an
+// object created now.
+func generatedAnnotations() map[string]string {
+	if ttl == 0 {
+		return objectAnnotations
+	}
+	annotations := map[string]string{expiresAnnotation: expiryOf()}
+	for k, v := range objectAnnotations {
+		annotations[k] = v
+	}
+	return annotations
+}
+
+func generatedLabels() map[string]string {
+	labels := map[string]string{runLabel: runName()}
+	for k, v := range objectLabels {
+		labels[k] = v
+	}
+	return labels
+}
+
+// selector is -labelSelector, narrowed down to the objects of -runPrefix if
+// set.
+func selector() string {
+	if runPrefix == "" {
+		return labelSelector
+	} else if labelSelector == "" {
+		return runLabel + "=" + runPrefix
+	}
+	return labelSelector + "," + runLabel + "=" + runPrefix
+}
+
+// runSelector selects what 'clean' deletes and 'orphans' reports: the
+// objects of -runPrefix or, without it, those of every run. Objects without
+// the run label were not created by cpburner and are never selected.
+func runSelector() string {
+	s := runLabel
+	if runPrefix != "" {
+		s = runLabel + "=" + runPrefix
+	}
+	if labelSelector != "" {
+		s = labelSelector + "," + s
+	}
+	return s
+}
+
+// writeContext bounds a create, update, apply, patch or delete by
+// -writeTimeout, so hung writes are recorded as timeouts instead of
+// blocking their worker for the whole -clientTimeout.
+func writeContext(ctx context.Context) (context.Context, context.CancelFunc) {
+	if writeTimeout == 0 {
+		return ctx, func() {}
+	}
+	return context.WithTimeout(ctx, writeTimeout)
+}
+
+func dryRunValue() []string {
+	if dryRun == dryRunServer {
+		return []string{metav1.DryRunAll}
+	}
+	return nil
+}
+
+func createOptions() metav1.CreateOptions {
+	return metav1.CreateOptions{DryRun: dryRunValue(), FieldValidation: fieldValidation}
+}
+
+func updateOptions() metav1.UpdateOptions {
+	return metav1.UpdateOptions{DryRun: dryRunValue(), FieldValidation: fieldValidation}
+}
+
+func patchOptions() metav1.PatchOptions {
+	return metav1.PatchOptions{DryRun: dryRunValue(), FieldValidation: fieldValidation}
+}
+
+// ApplyOptions has no FieldValidation in this client-go, so -fieldValidation
+// does not apply to server-side applies.
+func applyOptions(fieldManager string) metav1.ApplyOptions {
+	return metav1.ApplyOptions{FieldManager: fieldManager, Force: true, DryRun: dryRunValue()}
+}
+
+// deleteOptions of the deletes of generated objects, with -propagationPolicy
+// unless it is left to the server default.
+func deleteOptions() metav1.DeleteOptions {
+	if propagationPolicy == "" {
+		return metav1.DeleteOptions{}
+	}
+	policy := metav1.DeletionPropagation(propagationPolicy)
+	return metav1.DeleteOptions{PropagationPolicy: &policy}
+}
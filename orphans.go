@@ -0,0 +1,115 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"sort"
+	"time"
+
+	"cpburner/pkg/burner"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"k8s.io/client-go/dynamic"
+	"k8s.io/client-go/kubernetes"
+	"k8s.io/client-go/rest"
+)
+
+const actionOrphans = "orphans"
+
+// orphanRun sums up the objects a run left behind.
+type orphanRun struct {
+	run     string
+	objects int64
+	// bytes of the objects as JSON, about what etcd stores
+	bytes          int64
+	oldest, newest time.Time
+	expired        int64
+}
+
+// printOrphans lists the objects carrying the run label in every target
+// namespace, or every namespace of the cluster with -allNamespaces, and
+// prints how many objects of every run are left, how big and how old,
+// oldest run first. With -runPrefix only the objects of that run are
+// listed. Objects are matched by their run label alone, their names are
+// not checked against the run prefix.
+func printOrphans(config *rest.Config, resourceType string) error {
+	ctx := context.Background()
+	client, err := dynamic.NewForConfig(config)
+	if err != nil {
+		panic(err)
+	}
+	if allNamespaces {
+		clientset, err := kubernetes.NewForConfig(config)
+		if err != nil {
+			panic(err)
+		}
+		if err := useClusterNamespaces(ctx, clientset); err != nil {
+			return err
+		}
+	}
+	gvr := cleanResource(resourceType)
+	runs := map[string]*orphanRun{}
+	now := time.Now()
+	for _, ns := range targetNamespaces() {
+		opts := metav1.ListOptions{TimeoutSeconds: &timeout, Limit: listLimit, LabelSelector: runSelector(), FieldSelector: fieldSelector}
+		for {
+			var list *unstructured.UnstructuredList
+			err := burner.Retry(ctx, func() (err error) {
+				start := time.Now()
+				list, err = client.Resource(gvr).Namespace(ns).List(ctx, opts)
+				record(verbList, gvr.Resource, start, err)
+				return err
+			})
+			if err != nil {
+				return fmt.Errorf("listing the %s of namespace %s: %w", gvr.Resource, ns, err)
+			}
+			for _, obj := range list.Items {
+				run := obj.GetLabels()[runLabel]
+				r := runs[run]
+				if r == nil {
+					r = &orphanRun{run: run}
+					runs[run] = r
+				}
+				data, err := json.Marshal(obj.Object)
+				if err != nil {
+					panic(err)
+				}
+				created := obj.GetCreationTimestamp().Time
+				if r.objects == 0 || created.Before(r.oldest) {
+					r.oldest = created
+				}
+				if r.objects == 0 || created.After(r.newest) {
+					r.newest = created
+				}
+				r.objects++
+				r.bytes += int64(len(data))
+				if expired(obj.GetAnnotations(), now) {
+					r.expired++
+				}
+			}
+			if list.GetContinue() == "" {
+				break
+			}
+			opts.Continue = list.GetContinue()
+		}
+	}
+	sorted := []*orphanRun{}
+	var objects, bytes int64
+	for _, r := range runs {
+		sorted = append(sorted, r)
+		objects += r.objects
+		bytes += r.bytes
+	}
+	sort.Slice(sorted, func(i, j int) bool { return sorted[i].oldest.Before(sorted[j].oldest) })
+	for _, r := range sorted {
+		fmt.Fprintf(out, "%s: %d %s, %d bytes, oldest %s old, newest %s old", r.run, r.objects, gvr.Resource, r.bytes,
+			now.Sub(r.oldest).Round(time.Second), now.Sub(r.newest).Round(time.Second))
+		if r.expired > 0 {
+			fmt.Fprintf(out, ", %d expired", r.expired)
+		}
+		fmt.Fprintln(out)
+	}
+	fmt.Fprintf(out, "%d runs left %d %s, %d bytes, in %d namespaces\n", len(sorted), objects, gvr.Resource, bytes, len(targetNamespaces()))
+	return nil
+}
@@ -0,0 +1,345 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"math"
+	"strconv"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"golang.org/x/time/rate"
+)
+
+// minRampQPS keeps the limiter moving at the very start and end of a ramp,
+// where the linear rate would be zero.
+const minRampQPS = 1
+
+// loadStep is one step of a -steps profile.
+type loadStep struct {
+	qps      float64
+	duration time.Duration
+}
+
+var steps []loadStep
+
+// parseSteps parses a profile like "100qps:5m,500qps:5m".
+func parseSteps(s string) ([]loadStep, error) {
+	if s == "" {
+		return nil, nil
+	}
+	result := []loadStep{}
+	for _, part := range strings.Split(s, ",") {
+		rateStr, durationStr, ok := strings.Cut(strings.TrimSpace(part), ":")
+		if !ok {
+			return nil, fmt.Errorf("invalid step %q", part)
+		}
+		qps, err := strconv.ParseFloat(strings.TrimSuffix(rateStr, "qps"), 64)
+		if err != nil || qps <= 0 {
+			return nil, fmt.Errorf("invalid step rate %q", rateStr)
+		}
+		d, err := time.ParseDuration(durationStr)
+		if err != nil || d <= 0 {
+			return nil, fmt.Errorf("invalid step duration %q", durationStr)
+		}
+		result = append(result, loadStep{qps: qps, duration: d})
+	}
+	return result, nil
+}
+
+// pacer is a token bucket shared by every clientset of a run. Its rate ramps
+// linearly from zero to targetQPS over rampUp and back down over the last
+// rampDown of a duration-based run, oscillating around targetQPS when a wave
+// is configured and multiplied by burstFactor during bursts, or follows
+// -steps. It satisfies
+// flowcontrol.RateLimiter.
+type pacer struct {
+	// serializes rate changes of the schedule and the control APIs
+	mu      sync.Mutex
+	limiter *rate.Limiter
+	start   time.Time
+	stop    chan struct{}
+}
+
+func newPacer(start time.Time) *pacer {
+	p := &pacer{limiter: rate.NewLimiter(rate.Limit(targetQPS), 1), start: start, stop: make(chan struct{})}
+	if rampUp > 0 || rampDown > 0 || waveAmplitude > 0 || burstInterval > 0 || len(steps) > 0 {
+		p.limiter.SetLimit(rate.Limit(p.qpsAt(start)))
+		go p.ramp()
+	}
+	return p
+}
+
+// qpsAt is the rate the schedule asks for at t.
+func (p *pacer) qpsAt(t time.Time) float64 {
+	if len(steps) > 0 {
+		return steps[stepAt(p.start, t)].qps
+	}
+	elapsed := t.Sub(p.start)
+	base := targetQPS
+	if waveAmplitude > 0 {
+		base *= 1 + waveAmplitude*math.Sin(2*math.Pi*elapsed.Seconds()/wavePeriod.Seconds())
+	}
+	if inBurst(elapsed) {
+		base *= burstFactor
+	}
+	qps := base
+	if rampUp > 0 && elapsed < rampUp {
+		qps = base * elapsed.Seconds() / rampUp.Seconds()
+	}
+	if remaining := deadline.Sub(t); rampDown > 0 && remaining < rampDown {
+		if down := base * remaining.Seconds() / rampDown.Seconds(); down < qps {
+			qps = down
+		}
+	}
+	if qps < minRampQPS {
+		qps = minRampQPS
+	}
+	return qps
+}
+
+// schedule paces the requests of -openLoop runs. They bypass the clients'
+// rate limiting, which would otherwise couple them to completions again.
+var schedule *pacer
+
+// issue calls f for every request of a worker loop, i counting up from 0,
+// for count requests or until the deadline of a duration-based run. In
+// closed loop f runs inline, so a slow request delays the next one. In open
+// loop every request starts at its scheduled time in a goroutine of its own,
+// whether earlier ones completed or not, and issue waits for all of them.
+func issue(count int, f func(i int)) {
+	issueUntil(context.Background(), count, f)
+}
+
+// issueUntil is issue that also stops once ctx is done.
+func issueUntil(ctx context.Context, count int, f func(i int)) {
+	if schedule == nil {
+		for i := 0; ctx.Err() == nil && keepGoing(i, count); i++ {
+			if !gate.enter(ctx) {
+				return
+			}
+			f(i)
+			gate.leave()
+		}
+		return
+	}
+	wg := sync.WaitGroup{}
+	for i := 0; ctx.Err() == nil && keepGoing(i, count); i++ {
+		schedule.Accept()
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+			f(i)
+		}(i)
+	}
+	wg.Wait()
+}
+
+// workerGate lets limit of the -maxConcurrency workers of a closed loop run
+// issue a request at a time, so SetConcurrency can change the concurrency
+// of the run while it runs. It holds a token for every request allowed.
+type workerGate struct {
+	mu     sync.Mutex
+	limit  int
+	tokens chan struct{}
+}
+
+// gate is nil unless -maxConcurrency is set, a nil gate lets every worker
+// through.
+var gate *workerGate
+
+func newWorkerGate(limit int, max int) *workerGate {
+	g := &workerGate{limit: limit, tokens: make(chan struct{}, max)}
+	for i := 0; i < limit; i++ {
+		g.tokens <- struct{}{}
+	}
+	return g
+}
+
+// enter waits for a token, it returns false if the run ends meanwhile.
+func (g *workerGate) enter(ctx context.Context) bool {
+	if g == nil {
+		return true
+	}
+	for {
+		select {
+		case <-g.tokens:
+			return true
+		case <-ctx.Done():
+			return false
+		case <-time.After(100 * time.Millisecond):
+			if stopRequested() || !time.Now().Before(deadline) {
+				return false
+			}
+		}
+	}
+}
+
+func (g *workerGate) leave() {
+	if g != nil {
+		g.tokens <- struct{}{}
+	}
+}
+
+// setLimit hands out or takes back tokens until limit requests may run at a
+// time. Tokens held by requests in flight are taken back once they return.
+func (g *workerGate) setLimit(limit int) {
+	g.mu.Lock()
+	defer g.mu.Unlock()
+	for ; g.limit < limit; g.limit++ {
+		go func() { g.tokens <- struct{}{} }()
+	}
+	for ; g.limit > limit; g.limit-- {
+		go func() { <-g.tokens }()
+	}
+}
+
+func (g *workerGate) currentLimit() int {
+	g.mu.Lock()
+	defer g.mu.Unlock()
+	return g.limit
+}
+
+// stepAt is the index of the step running at t, the last one once the
+// profile is over.
+func stepAt(start time.Time, t time.Time) int {
+	end := start
+	for i, step := range steps {
+		end = end.Add(step.duration)
+		if t.Before(end) {
+			return i
+		}
+	}
+	return len(steps) - 1
+}
+
+func (p *pacer) ramp() {
+	ticker := time.NewTicker(100 * time.Millisecond)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-p.stop:
+			return
+		case now := <-ticker.C:
+			p.mu.Lock()
+			p.limiter.SetLimit(rate.Limit(p.qpsAt(now)))
+			p.mu.Unlock()
+		}
+	}
+}
+
+// setTarget changes targetQPS while p runs, a ramp, wave or bursts keep
+// following it.
+func (p *pacer) setTarget(qps float64) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	targetQPS = qps
+	p.limiter.SetLimit(rate.Limit(p.qpsAt(time.Now())))
+}
+
+func (p *pacer) TryAccept() bool {
+	return p.limiter.Allow()
+}
+
+func (p *pacer) Accept() {
+	p.limiter.Wait(context.Background())
+}
+
+func (p *pacer) Wait(ctx context.Context) error {
+	return p.limiter.Wait(ctx)
+}
+
+func (p *pacer) Stop() {
+	close(p.stop)
+}
+
+func (p *pacer) QPS() float32 {
+	return float32(p.limiter.Limit())
+}
+
+// window summarizes the requests recorded since it was last reset.
+type window struct {
+	requests, failures, latency int64
+	time                        time.Time
+}
+
+func (w *window) reset() {
+	w.failures = atomic.LoadInt64(&counterFailure)
+	w.requests = atomic.LoadInt64(&counterSuccess) + w.failures + atomic.LoadInt64(&counterOversized)
+	w.latency = atomic.LoadInt64(&counterLatency)
+	w.time = time.Now()
+}
+
+// windowStats is what happened within a window.
+type windowStats struct {
+	requests, failures int64
+	elapsed            time.Duration
+	mean               time.Duration
+}
+
+func (s windowStats) rate() float64 {
+	return float64(s.requests) / s.elapsed.Seconds()
+}
+
+// advance returns the statistics of the window and resets it.
+func (w *window) advance() windowStats {
+	last := *w
+	w.reset()
+	s := windowStats{requests: w.requests - last.requests, failures: w.failures - last.failures, elapsed: w.time.Sub(last.time)}
+	if s.requests > 0 {
+		s.mean = time.Duration((w.latency - last.latency) / s.requests)
+	}
+	return s
+}
+
+// flush summarizes the window and resets it.
+func (w *window) flush() string {
+	s := w.advance()
+	return fmt.Sprintf("%d requests, %d failures, %.1f requests/s, mean latency %s", s.requests, s.failures, s.rate(), round(s.mean))
+}
+
+var stepWindow window
+
+// reportSteps prints the statistics of every step but the last as it ends,
+// main prints the last one once the workload is done.
+func reportSteps(start time.Time) {
+	stepWindow.reset()
+	runPhaseHook(0)
+	end := start
+	for i := 0; i < len(steps)-1; i++ {
+		end = end.Add(steps[i].duration)
+		time.Sleep(time.Until(end))
+		printStep(i)
+		runPhaseHook(i + 1)
+	}
+}
+
+func printStep(i int) {
+	fmt.Fprintf(out, "step %d (%gqps for %s): %s\n", i+1, steps[i].qps, steps[i].duration, stepWindow.flush())
+}
+
+// inBurst tells whether the last burstDuration of the burstInterval that
+// elapsed falls into is running.
+func inBurst(elapsed time.Duration) bool {
+	return burstInterval > 0 && elapsed%burstInterval >= burstInterval-burstDuration
+}
+
+// reportBursts prints the statistics of every burst and of the baseline
+// load preceding it, until the run is over.
+func reportBursts(start time.Time) {
+	var w window
+	w.reset()
+	for i := 1; ; i++ {
+		burstStart := start.Add(time.Duration(i)*burstInterval - burstDuration)
+		burstEnd := start.Add(time.Duration(i) * burstInterval)
+		if duration > 0 && burstEnd.After(deadline) {
+			return
+		}
+		time.Sleep(time.Until(burstStart))
+		fmt.Fprintf(out, "baseline before burst %d (%gqps): %s\n", i, targetQPS, w.flush())
+		time.Sleep(time.Until(burstEnd))
+		fmt.Fprintf(out, "burst %d (%gqps for %s): %s\n", i, targetQPS*burstFactor, burstDuration, w.flush())
+	}
+}
@@ -0,0 +1,119 @@
+package main
+
+import (
+	"fmt"
+	"math"
+	"strconv"
+	"strings"
+)
+
+// maxPayloadSize caps the sizes drawn from the normal and pareto
+// distributions below the 1MiB limit on the data of a ConfigMap.
+const maxPayloadSize = 1<<20 - 1024
+
+const (
+	payloadUniform = "uniform"
+	payloadNormal  = "normal"
+	payloadPareto  = "pareto"
+)
+
+// payloadDist draws payload sizes from a random distribution, uniform
+// between a and b, normal with mean a and standard deviation b, or pareto
+// with minimum a and shape b.
+type payloadDist struct {
+	kind string
+	a, b float64
+}
+
+// payloadDistribution is nil when every payload has -payloadSize bytes.
+var payloadDistribution *payloadDist
+
+// parsePayloadDistribution parses a distribution like "pareto:1024:1.5".
+func parsePayloadDistribution(s string) (*payloadDist, error) {
+	if s == "" {
+		return nil, nil
+	}
+	parts := strings.Split(s, ":")
+	if len(parts) != 3 {
+		return nil, fmt.Errorf("invalid distribution %q", s)
+	}
+	d := &payloadDist{kind: parts[0]}
+	var err error
+	if d.a, err = strconv.ParseFloat(parts[1], 64); err != nil {
+		return nil, err
+	}
+	if d.b, err = strconv.ParseFloat(parts[2], 64); err != nil {
+		return nil, err
+	}
+	switch d.kind {
+	case payloadUniform:
+		if d.a < 0 || d.b < d.a || d.b > maxPayloadSize {
+			return nil, fmt.Errorf("uniform needs 0 <= min <= max <= %d", maxPayloadSize)
+		}
+	case payloadNormal:
+		if d.a < 0 || d.b < 0 {
+			return nil, fmt.Errorf("normal needs a mean and standard deviation of at least 0")
+		}
+	case payloadPareto:
+		if d.a < 1 || d.b <= 0 {
+			return nil, fmt.Errorf("pareto needs a minimum of at least 1 and a positive shape")
+		}
+	default:
+		return nil, fmt.Errorf("unknown distribution %q", d.kind)
+	}
+	return d, nil
+}
+
+// max is the largest size d draws.
+func (d *payloadDist) max() int {
+	if d.kind == payloadUniform {
+		return int(d.b)
+	}
+	return maxPayloadSize
+}
+
+// size draws the payload size of the object name. It depends on the name
+// and -seed only, so runs with the same seed generate the same objects
+// however their requests interleave.
+func (d *payloadDist) size(name string) int {
+	u := unitHash(name, 0)
+	var size float64
+	switch d.kind {
+	case payloadUniform:
+		size = d.a + u*(d.b-d.a)
+	case payloadNormal:
+		// Box-Muller transform
+		size = d.a + d.b*math.Sqrt(-2*math.Log(1-u))*math.Cos(2*math.Pi*unitHash(name, 1))
+	case payloadPareto:
+		size = d.a / math.Pow(1-u, 1/d.b)
+	}
+	if size < 0 {
+		return 0
+	}
+	if size > float64(d.max()) {
+		return d.max()
+	}
+	return int(math.Round(size))
+}
+
+// initPayload generates the random letters payloads are cut from.
+func initPayload() {
+	if payloadDistribution != nil {
+		testMsg = randomString(payloadDistribution.max())
+	} else {
+		testMsg = randomString(payloadSize)
+	}
+}
+
+// payload is the random payload of the generated event or configmap name.
+func payload(name string) string {
+	if payloadDistribution == nil {
+		return testMsg
+	}
+	return testMsg[:payloadDistribution.size(name)]
+}
+
+// unitHash maps name, i and -seed onto [0, 1).
+func unitHash(name string, i int) float64 {
+	return float64(nameHash(fmt.Sprintf("%s-%d", name, seed), i)>>11) / (1 << 53)
+}
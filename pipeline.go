@@ -0,0 +1,131 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"strings"
+	"sync"
+	"time"
+
+	"k8s.io/client-go/kubernetes"
+	"k8s.io/client-go/rest"
+)
+
+type latencyStats struct {
+	mu       sync.Mutex
+	count    int64
+	failures int64
+	total    time.Duration
+	min      time.Duration
+	max      time.Duration
+}
+
+func (s *latencyStats) observe(d time.Duration, err error) {
+	if warmingUp() {
+		return
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if err != nil {
+		s.failures++
+	}
+	if s.count == 0 || d < s.min {
+		s.min = d
+	}
+	if d > s.max {
+		s.max = d
+	}
+	s.count++
+	s.total += d
+}
+
+func (s *latencyStats) mean() time.Duration {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.count == 0 {
+		return 0
+	}
+	return s.total / time.Duration(s.count)
+}
+
+func (s *latencyStats) String() string {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.count == 0 {
+		return "no requests"
+	}
+	return fmt.Sprintf("%d requests, %d failures, mean %s, min %s, max %s",
+		s.count, s.failures, s.total/time.Duration(s.count), s.min, s.max)
+}
+
+// parsePipeline parses a stage list like "create,get,update,delete". Every
+// pipeline starts with create, since the later stages act on that object.
+func parsePipeline(s string) ([]string, error) {
+	stages := strings.Split(s, ",")
+	for i, stage := range stages {
+		stage = strings.TrimSpace(stage)
+		switch stage {
+		case verbCreate, verbGet, verbUpdate, verbDelete:
+		default:
+			return nil, fmt.Errorf("unknown pipeline stage %q", stage)
+		}
+		stages[i] = stage
+	}
+	if stages[0] != verbCreate {
+		return nil, fmt.Errorf("pipeline must start with %s", verbCreate)
+	}
+	return stages, nil
+}
+
+// pipelineLoad takes resourceCount objects through stages one after another,
+// sleeping pipelineThinkTime between stages, and reports the latency of every
+// stage. An object's pipeline stops at its first failed stage.
+func pipelineLoad(config *rest.Config, resourceCount int, resourceType string, stages []string) {
+	ctx := context.Background()
+	stats := make([]*latencyStats, len(stages))
+	for i := range stats {
+		stats[i] = &latencyStats{}
+	}
+	wg := sync.WaitGroup{}
+	count := int(resourceCount / concurrency)
+	for i := 0; i < concurrency; i++ {
+		wg.Add(1)
+		go func(prefix string) {
+			defer wg.Done()
+			clientset, err := kubernetes.NewForConfig(workerConfig(config))
+			if err != nil {
+				panic(err)
+			}
+			c := &objectClient{clientset: clientset, resourceType: resourceType}
+			issue(count, func(j int) {
+				name := objectName(prefix, j)
+				for k, stage := range stages {
+					if k > 0 && pipelineThinkTime > 0 {
+						time.Sleep(pipelineThinkTime)
+					}
+					start := time.Now()
+					var err error
+					switch stage {
+					case verbCreate:
+						err = c.create(ctx, name)
+					case verbGet:
+						err = c.get(ctx, name)
+					case verbUpdate:
+						err = c.update(ctx, name)
+					case verbDelete:
+						err = c.delete(ctx, name)
+					}
+					stats[k].observe(time.Since(start), err)
+					if err != nil {
+						break
+					}
+				}
+			})
+		}(fmt.Sprintf("%s-%d", globalPrefix, i))
+	}
+	wg.Wait()
+
+	for k, stage := range stages {
+		fmt.Fprintf(out, "stage %d (%s): %s\n", k+1, stage, stats[k])
+	}
+}
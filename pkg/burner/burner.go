@@ -0,0 +1,410 @@
+// Package burner creates, lists and deletes ConfigMaps, Events or the objects
+// of another registered ResourceGenerator in bulk to load the control plane,
+// etcd in particular. Other programs can embed these loads, e.g. in their
+// own test harness.
+//
+// It covers the 'create', 'list' and 'clean' actions of the cpburner
+// command only. The command's other actions, its flags, pacing, statistics
+// and reports stay in package main, which configures a Burner from its
+// flags for those three actions.
+package burner
+
+import (
+	"context"
+	"fmt"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	apiv1 "k8s.io/api/core/v1"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/client-go/kubernetes"
+	"k8s.io/client-go/rest"
+)
+
+// Resource types a Burner generates.
+const (
+	ConfigMap = "configmap"
+	Event     = "event"
+)
+
+// Verbs passed to Observe.
+const (
+	VerbCreate = "create"
+	VerbList   = "list"
+	VerbDelete = "delete"
+)
+
+// Burner generates objects, lists them and deletes them again. Failed
+// requests are passed to Options.Observe and do not stop a Burner. Lists
+// that fail transiently are retried, the returned errors are those it
+// cannot go on after, wrapped with what it was doing.
+type Burner interface {
+	// Create creates Options.Count objects. The workers take them from a
+	// shared queue, so a slow worker does not hold up the others.
+	Create(ctx context.Context) error
+	// List pages through the objects of every namespace from every worker.
+	// It skips the rest of a namespace whose list keeps failing transiently,
+	// and stops on other failures.
+	List(ctx context.Context) error
+	// Clean deletes the selected objects one by one, until only those
+	// already terminating are left, e.g. held by a finalizer. It goes on
+	// with the other namespaces when the list of one keeps failing
+	// transiently, and returns that failure at the end. A delete failing
+	// otherwise stops it, objects that are gone already do not.
+	Clean(ctx context.Context) error
+}
+
+// Options configure a Burner. Only Config is required. Without the hooks,
+// objects are named Prefix-<worker>-<i>, live in the first of Namespaces and
+// carry a payload of PayloadSize bytes.
+type Options struct {
+	// Config of the cluster to burn.
+	Config *rest.Config
+	// ResourceType is ConfigMap, the default, Event or another registered
+	// type.
+	ResourceType string
+	// Prefix of the object names, "cpburner" by default.
+	Prefix string
+	// Concurrency is the number of workers, 1 by default.
+	Concurrency int
+	// Clientsets is the number of clientsets the Create workers share,
+	// one per worker by default.
+	Clientsets int
+	// Count of the objects Create creates, a negative Count creates them
+	// until Issue stops.
+	Count int
+	// PayloadSize of the default payload.
+	PayloadSize int
+	// Namespaces to list and clean, "default" by default.
+	Namespaces []string
+	// ListLimit is the page size of lists, 0 lists everything at once.
+	ListLimit int64
+	// ListTimeoutSeconds the server is asked to finish every list within.
+	ListTimeoutSeconds int64
+	// ListResourceVersion and ListResourceVersionMatch of the first page of
+	// every List, e.g. "0" to be served from the watch cache. The next pages
+	// stick to the snapshot of the first.
+	ListResourceVersion      string
+	ListResourceVersionMatch metav1.ResourceVersionMatch
+	// LabelSelector of the objects to list and clean.
+	LabelSelector string
+	// FieldSelector of the objects to clean.
+	FieldSelector string
+	// CreateOptions of every create.
+	CreateOptions metav1.CreateOptions
+	// DeleteOptions of every delete, e.g. its propagation policy.
+	DeleteOptions metav1.DeleteOptions
+	// WriteTimeout bounds every create and delete, 0 means no bound.
+	WriteTimeout time.Duration
+
+	// WorkerConfig returns the config a Create worker builds its clientset
+	// from, Config itself by default.
+	WorkerConfig func(config *rest.Config) *rest.Config
+	// Name returns the name of the i-th object of the worker with prefix.
+	Name func(prefix string, i int) string
+	// NamespaceOf returns the namespace to create the object name in.
+	NamespaceOf func(name string) string
+	// Meta returns the metadata of the object name.
+	Meta func(name string) metav1.ObjectMeta
+	// Payload returns the payload of the object name.
+	Payload func(name string) string
+	// InvolvedObject returns the object the Event name is about.
+	InvolvedObject func(name string) apiv1.ObjectReference
+	// Skip tells Create to leave out the object name, e.g. because it
+	// exists already.
+	Skip func(name string) bool
+	// Issue calls f for i counting up from 0 to count, pacing the requests
+	// of a worker, and stops once ctx is done. By default it calls f back
+	// to back, until ctx is done if count is negative.
+	Issue func(ctx context.Context, count int, f func(i int))
+	// Created is called with the name of every object Create created.
+	Created func(name string)
+	// Deleted is called with the name of every object Clean deleted.
+	Deleted func(name string)
+	// Terminating is called with the name of every object Clean left
+	// terminating behind.
+	Terminating func(name string)
+	// Observe is called with the outcome of every request.
+	Observe func(verb string, resource string, start time.Time, err error)
+}
+
+type burner struct {
+	Options
+	generator ResourceGenerator
+	resource  string
+}
+
+// New checks opts and fills in the defaults of those left empty.
+func New(opts Options) (Burner, error) {
+	if opts.Config == nil {
+		return nil, fmt.Errorf("no config")
+	}
+	b := &burner{Options: opts}
+	if b.ResourceType == "" {
+		b.ResourceType = ConfigMap
+	}
+	b.generator = Generator(b.ResourceType)
+	if b.generator == nil {
+		return nil, fmt.Errorf("unknown resource type %q", b.ResourceType)
+	}
+	b.resource = b.generator.Spec().Resource
+	if b.Prefix == "" {
+		b.Prefix = "cpburner"
+	}
+	if b.Concurrency < 1 {
+		b.Concurrency = 1
+	}
+	if b.Clientsets < 1 || b.Clientsets > b.Concurrency {
+		b.Clientsets = b.Concurrency
+	}
+	if len(b.Namespaces) == 0 {
+		b.Namespaces = []string{metav1.NamespaceDefault}
+	}
+	if b.WorkerConfig == nil {
+		b.WorkerConfig = func(config *rest.Config) *rest.Config { return config }
+	}
+	if b.Name == nil {
+		b.Name = func(prefix string, i int) string { return fmt.Sprintf("%s-%d", prefix, i) }
+	}
+	if b.NamespaceOf == nil {
+		b.NamespaceOf = func(string) string { return b.Namespaces[0] }
+	}
+	if b.Meta == nil {
+		b.Meta = func(name string) metav1.ObjectMeta { return metav1.ObjectMeta{Name: name} }
+	}
+	if b.Payload == nil {
+		payload := strings.Repeat("x", b.PayloadSize)
+		b.Payload = func(string) string { return payload }
+	}
+	if b.InvolvedObject == nil {
+		b.InvolvedObject = func(name string) apiv1.ObjectReference {
+			return apiv1.ObjectReference{Kind: "Pod", APIVersion: "v1", Namespace: b.NamespaceOf(name), Name: name}
+		}
+	}
+	if b.Skip == nil {
+		b.Skip = func(string) bool { return false }
+	}
+	if b.Issue == nil {
+		b.Issue = func(ctx context.Context, count int, f func(i int)) {
+			for i := 0; (count < 0 || i < count) && ctx.Err() == nil; i++ {
+				f(i)
+			}
+		}
+	}
+	if b.Created == nil {
+		b.Created = func(string) {}
+	}
+	if b.Deleted == nil {
+		b.Deleted = func(string) {}
+	}
+	if b.Terminating == nil {
+		b.Terminating = func(string) {}
+	}
+	if b.Observe == nil {
+		b.Observe = func(string, string, time.Time, error) {}
+	}
+	return b, nil
+}
+
+// workers runs f once per worker, worker i with the prefix Prefix-i, and
+// returns the first error.
+func (b *burner) workers(f func(prefix string) error) error {
+	wg := sync.WaitGroup{}
+	errs := make(chan error, b.Concurrency)
+	for i := 0; i < b.Concurrency; i++ {
+		wg.Add(1)
+		go func(prefix string) {
+			defer wg.Done()
+			if err := f(prefix); err != nil {
+				errs <- err
+			}
+		}(fmt.Sprintf("%s-%d", b.Prefix, i))
+	}
+	wg.Wait()
+	close(errs)
+	return <-errs
+}
+
+// Object i of the queue is named object i/Concurrency of the worker prefix
+// Prefix-<i%Concurrency>, so the names do not depend on which worker took
+// it.
+func (b *burner) Create(ctx context.Context) error {
+	clientsets := make([]kubernetes.Interface, b.Clientsets)
+	for i := range clientsets {
+		clientset, err := kubernetes.NewForConfig(b.WorkerConfig(b.Config))
+		if err != nil {
+			return err
+		}
+		clientsets[i] = clientset
+	}
+	// issueCtx is done once the queue is drained or the workers ended, the
+	// requests in flight still complete under ctx
+	issueCtx, cancel := context.WithCancel(ctx)
+	defer cancel()
+	queue := make(chan string)
+	count := b.Count
+	if count > 0 {
+		count = count / b.Concurrency * b.Concurrency
+	}
+	go func() {
+		defer cancel()
+		for i := 0; count < 0 || i < count; i++ {
+			name := b.Name(fmt.Sprintf("%s-%d", b.Prefix, i%b.Concurrency), i/b.Concurrency)
+			if b.Skip(name) {
+				continue
+			}
+			select {
+			case queue <- name:
+			case <-issueCtx.Done():
+				return
+			}
+		}
+	}()
+	var worker int32
+	return b.workers(func(string) error {
+		clientset := clientsets[int(atomic.AddInt32(&worker, 1)-1)%len(clientsets)]
+		b.Issue(issueCtx, count, func(int) {
+			var name string
+			select {
+			case name = <-queue:
+			case <-issueCtx.Done():
+				return
+			}
+			start := time.Now()
+			err := b.create(ctx, clientset, name)
+			b.Observe(VerbCreate, b.resource, start, err)
+			if err == nil {
+				b.Created(name)
+			}
+		})
+		return nil
+	})
+}
+
+func (b *burner) create(ctx context.Context, clientset kubernetes.Interface, name string) error {
+	ctx, cancel := b.writeContext(ctx)
+	defer cancel()
+	meta := b.Meta(name)
+	meta.Namespace = b.NamespaceOf(name)
+	return b.generator.Create(ctx, clientset, Object{Meta: meta, Payload: b.Payload(name), InvolvedObject: b.InvolvedObject(name)}, b.CreateOptions)
+}
+
+func (b *burner) List(ctx context.Context) error {
+	return b.workers(func(string) error {
+		clientset, err := kubernetes.NewForConfig(b.Config)
+		if err != nil {
+			return err
+		}
+		for _, ns := range b.Namespaces {
+			continueString := ""
+			for {
+				var next string
+				opts := metav1.ListOptions{LabelSelector: b.LabelSelector, Continue: continueString}
+				if continueString == "" {
+					opts.ResourceVersion, opts.ResourceVersionMatch = b.ListResourceVersion, b.ListResourceVersionMatch
+				}
+				err := Retry(ctx, func() (err error) {
+					start := time.Now()
+					_, next, err = b.listPage(ctx, clientset, ns, opts)
+					b.Observe(VerbList, b.resource, start, err)
+					return err
+				})
+				if err != nil && !IsTransient(err) {
+					return fmt.Errorf("listing %s in namespace %s: %w", b.resource, ns, err)
+				}
+				if err != nil || next == "" {
+					break
+				}
+				continueString = next
+			}
+		}
+		return nil
+	})
+}
+
+func (b *burner) Clean(ctx context.Context) error {
+	clientset, err := kubernetes.NewForConfig(b.Config)
+	if err != nil {
+		return err
+	}
+	var failed error
+	for _, ns := range b.Namespaces {
+		// every pass pages through the whole namespace, the last one issued
+		// no delete and found only the terminating objects
+		continueString := ""
+		deletes := 0
+		terminating := []string{}
+		for {
+			var metas []metav1.ObjectMeta
+			var next string
+			err := Retry(ctx, func() (err error) {
+				metas, next, err = b.listPage(ctx, clientset, ns, metav1.ListOptions{LabelSelector: b.LabelSelector, FieldSelector: b.FieldSelector, Continue: continueString})
+				return err
+			})
+			if err != nil {
+				transient := IsTransient(err)
+				err = fmt.Errorf("listing %s in namespace %s: %w", b.resource, ns, err)
+				if !transient {
+					return err
+				}
+				if failed == nil {
+					failed = err
+				}
+				break
+			}
+			for _, meta := range metas {
+				if meta.DeletionTimestamp != nil {
+					terminating = append(terminating, meta.Name)
+					continue
+				}
+				start := time.Now()
+				err := b.delete(ctx, clientset, ns, meta.Name)
+				b.Observe(VerbDelete, b.resource, start, err)
+				if err == nil {
+					b.Deleted(meta.Name)
+				} else if !IsTransient(err) && !apierrors.IsNotFound(err) {
+					return fmt.Errorf("deleting %s %s/%s: %w", b.resource, ns, meta.Name, err)
+				}
+				deletes++
+			}
+			if continueString = next; continueString != "" {
+				continue
+			}
+			if deletes == 0 {
+				for _, name := range terminating {
+					b.Terminating(name)
+				}
+				break
+			}
+			deletes, terminating = 0, terminating[:0]
+		}
+	}
+	return failed
+}
+
+// listPage lists a page of objects in ns and returns their metadata and the
+// continue token of the next page.
+func (b *burner) listPage(ctx context.Context, clientset kubernetes.Interface, ns string, opts metav1.ListOptions) ([]metav1.ObjectMeta, string, error) {
+	opts.Limit = b.ListLimit
+	if b.ListTimeoutSeconds > 0 {
+		opts.TimeoutSeconds = &b.ListTimeoutSeconds
+	}
+	metas, listMeta, err := b.generator.List(ctx, clientset, ns, opts)
+	return metas, listMeta.Continue, err
+}
+
+func (b *burner) delete(ctx context.Context, clientset kubernetes.Interface, ns string, name string) error {
+	ctx, cancel := b.writeContext(ctx)
+	defer cancel()
+	return b.generator.Delete(ctx, clientset, ns, name, b.DeleteOptions)
+}
+
+func (b *burner) writeContext(ctx context.Context) (context.Context, context.CancelFunc) {
+	if b.WriteTimeout == 0 {
+		return ctx, func() {}
+	}
+	return context.WithTimeout(ctx, b.WriteTimeout)
+}
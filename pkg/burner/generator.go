@@ -0,0 +1,239 @@
+package burner
+
+import (
+	"context"
+	"fmt"
+	"sort"
+
+	apiv1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime/schema"
+	"k8s.io/apimachinery/pkg/watch"
+	corev1ac "k8s.io/client-go/applyconfigurations/core/v1"
+	"k8s.io/client-go/kubernetes"
+)
+
+// ResourceSpec describes the objects of a ResourceGenerator.
+type ResourceSpec struct {
+	// Type selects the generator, e.g. ConfigMap.
+	Type string
+	// Resource is the plural API resource, e.g. "configmaps".
+	Resource string
+	// Kind of the objects, e.g. "ConfigMap".
+	Kind string
+	// Group and Version of the API serving Resource, "" and "v1" for the
+	// core API.
+	Group   string
+	Version string
+}
+
+// GVR is the group, version and resource of the objects.
+func (s ResourceSpec) GVR() schema.GroupVersionResource {
+	return schema.GroupVersionResource{Group: s.Group, Version: s.Version, Resource: s.Resource}
+}
+
+// Object is what a ResourceGenerator creates.
+type Object struct {
+	// Meta of the object, its Namespace included.
+	Meta metav1.ObjectMeta
+	// Payload is the bulk of the object, where the generator puts it.
+	Payload string
+	// InvolvedObject is what an Event is about, other kinds ignore it.
+	InvolvedObject apiv1.ObjectReference
+}
+
+// ResourceGenerator creates, reads, writes, lists, watches and deletes the
+// objects of one resource type. Register makes it available to New and the
+// cpburner command.
+type ResourceGenerator interface {
+	Spec() ResourceSpec
+	Create(ctx context.Context, clientset kubernetes.Interface, obj Object, opts metav1.CreateOptions) error
+	// Get reads the object name in ns back.
+	Get(ctx context.Context, clientset kubernetes.Interface, ns string, name string, opts metav1.GetOptions) (Object, error)
+	// Update replaces the object with obj, conditional on the
+	// resourceVersion of obj.Meta if it has one.
+	Update(ctx context.Context, clientset kubernetes.Interface, obj Object, opts metav1.UpdateOptions) error
+	// Apply server-side applies the metadata of obj and, unless it is
+	// empty, its payload as the field manager of opts.
+	Apply(ctx context.Context, clientset kubernetes.Interface, obj Object, opts metav1.ApplyOptions) error
+	// List lists a page of objects in ns and returns their metadata and that
+	// of the list, with the continue token of the next page.
+	List(ctx context.Context, clientset kubernetes.Interface, ns string, opts metav1.ListOptions) ([]metav1.ObjectMeta, metav1.ListMeta, error)
+	Watch(ctx context.Context, clientset kubernetes.Interface, ns string, opts metav1.ListOptions) (watch.Interface, error)
+	Delete(ctx context.Context, clientset kubernetes.Interface, ns string, name string, opts metav1.DeleteOptions) error
+	// DeleteCollection deletes the objects in ns listOpts selects.
+	DeleteCollection(ctx context.Context, clientset kubernetes.Interface, ns string, opts metav1.DeleteOptions, listOpts metav1.ListOptions) error
+}
+
+var generators = map[string]ResourceGenerator{}
+
+// Register adds g under g.Spec().Type, it panics if the type is taken.
+func Register(g ResourceGenerator) {
+	t := g.Spec().Type
+	if _, ok := generators[t]; ok {
+		panic(fmt.Sprintf("resource type %q registered twice", t))
+	}
+	generators[t] = g
+}
+
+// Generator returns the generator registered for resourceType, nil if there
+// is none.
+func Generator(resourceType string) ResourceGenerator {
+	return generators[resourceType]
+}
+
+// ResourceTypes returns the registered resource types in order.
+func ResourceTypes() []string {
+	types := []string{}
+	for t := range generators {
+		types = append(types, t)
+	}
+	sort.Strings(types)
+	return types
+}
+
+func init() {
+	Register(configMapGenerator{})
+	Register(eventGenerator{})
+}
+
+type configMapGenerator struct{}
+
+func (configMapGenerator) Spec() ResourceSpec {
+	return ResourceSpec{Type: ConfigMap, Resource: "configmaps", Kind: "ConfigMap", Version: "v1"}
+}
+
+func (configMapGenerator) Create(ctx context.Context, clientset kubernetes.Interface, obj Object, opts metav1.CreateOptions) error {
+	_, err := clientset.CoreV1().ConfigMaps(obj.Meta.Namespace).Create(ctx, configMapOf(obj), opts)
+	return err
+}
+
+func (configMapGenerator) Get(ctx context.Context, clientset kubernetes.Interface, ns string, name string, opts metav1.GetOptions) (Object, error) {
+	cm, err := clientset.CoreV1().ConfigMaps(ns).Get(ctx, name, opts)
+	if err != nil {
+		return Object{}, err
+	}
+	return Object{Meta: cm.ObjectMeta, Payload: cm.Data[configMapPayloadKey]}, nil
+}
+
+func (configMapGenerator) Update(ctx context.Context, clientset kubernetes.Interface, obj Object, opts metav1.UpdateOptions) error {
+	_, err := clientset.CoreV1().ConfigMaps(obj.Meta.Namespace).Update(ctx, configMapOf(obj), opts)
+	return err
+}
+
+func (configMapGenerator) Apply(ctx context.Context, clientset kubernetes.Interface, obj Object, opts metav1.ApplyOptions) error {
+	spec := corev1ac.ConfigMap(obj.Meta.Name, obj.Meta.Namespace).
+		WithLabels(obj.Meta.Labels).WithAnnotations(obj.Meta.Annotations).WithFinalizers(obj.Meta.Finalizers...)
+	if obj.Payload != "" {
+		spec.WithData(map[string]string{configMapPayloadKey: obj.Payload})
+	}
+	_, err := clientset.CoreV1().ConfigMaps(obj.Meta.Namespace).Apply(ctx, spec, opts)
+	return err
+}
+
+func (configMapGenerator) List(ctx context.Context, clientset kubernetes.Interface, ns string, opts metav1.ListOptions) ([]metav1.ObjectMeta, metav1.ListMeta, error) {
+	list, err := clientset.CoreV1().ConfigMaps(ns).List(ctx, opts)
+	if err != nil {
+		return nil, metav1.ListMeta{}, err
+	}
+	metas := make([]metav1.ObjectMeta, 0, len(list.Items))
+	for _, cm := range list.Items {
+		metas = append(metas, cm.ObjectMeta)
+	}
+	return metas, list.ListMeta, nil
+}
+
+func (configMapGenerator) Watch(ctx context.Context, clientset kubernetes.Interface, ns string, opts metav1.ListOptions) (watch.Interface, error) {
+	return clientset.CoreV1().ConfigMaps(ns).Watch(ctx, opts)
+}
+
+func (configMapGenerator) Delete(ctx context.Context, clientset kubernetes.Interface, ns string, name string, opts metav1.DeleteOptions) error {
+	return clientset.CoreV1().ConfigMaps(ns).Delete(ctx, name, opts)
+}
+
+func (configMapGenerator) DeleteCollection(ctx context.Context, clientset kubernetes.Interface, ns string, opts metav1.DeleteOptions, listOpts metav1.ListOptions) error {
+	return clientset.CoreV1().ConfigMaps(ns).DeleteCollection(ctx, opts, listOpts)
+}
+
+// configMapPayloadKey is the key of the payload in the data of a ConfigMap.
+const configMapPayloadKey = "CPburnerTest"
+
+func configMapOf(obj Object) *apiv1.ConfigMap {
+	return &apiv1.ConfigMap{
+		ObjectMeta: obj.Meta,
+		Data:       map[string]string{configMapPayloadKey: obj.Payload},
+	}
+}
+
+type eventGenerator struct{}
+
+func (eventGenerator) Spec() ResourceSpec {
+	return ResourceSpec{Type: Event, Resource: "events", Kind: "Event", Version: "v1"}
+}
+
+func (eventGenerator) Create(ctx context.Context, clientset kubernetes.Interface, obj Object, opts metav1.CreateOptions) error {
+	_, err := clientset.CoreV1().Events(obj.Meta.Namespace).Create(ctx, eventOf(obj), opts)
+	return err
+}
+
+func (eventGenerator) Get(ctx context.Context, clientset kubernetes.Interface, ns string, name string, opts metav1.GetOptions) (Object, error) {
+	e, err := clientset.CoreV1().Events(ns).Get(ctx, name, opts)
+	if err != nil {
+		return Object{}, err
+	}
+	return Object{Meta: e.ObjectMeta, Payload: e.Message, InvolvedObject: e.InvolvedObject}, nil
+}
+
+func (eventGenerator) Update(ctx context.Context, clientset kubernetes.Interface, obj Object, opts metav1.UpdateOptions) error {
+	_, err := clientset.CoreV1().Events(obj.Meta.Namespace).Update(ctx, eventOf(obj), opts)
+	return err
+}
+
+func (eventGenerator) Apply(ctx context.Context, clientset kubernetes.Interface, obj Object, opts metav1.ApplyOptions) error {
+	spec := corev1ac.Event(obj.Meta.Name, obj.Meta.Namespace).
+		WithLabels(obj.Meta.Labels).WithAnnotations(obj.Meta.Annotations).WithFinalizers(obj.Meta.Finalizers...)
+	if obj.Payload != "" {
+		ref := obj.InvolvedObject
+		spec.WithReason(eventReason).WithMessage(obj.Payload).WithInvolvedObject(corev1ac.ObjectReference().
+			WithKind(ref.Kind).WithAPIVersion(ref.APIVersion).WithNamespace(ref.Namespace).WithName(ref.Name))
+	}
+	_, err := clientset.CoreV1().Events(obj.Meta.Namespace).Apply(ctx, spec, opts)
+	return err
+}
+
+func (eventGenerator) List(ctx context.Context, clientset kubernetes.Interface, ns string, opts metav1.ListOptions) ([]metav1.ObjectMeta, metav1.ListMeta, error) {
+	list, err := clientset.CoreV1().Events(ns).List(ctx, opts)
+	if err != nil {
+		return nil, metav1.ListMeta{}, err
+	}
+	metas := make([]metav1.ObjectMeta, 0, len(list.Items))
+	for _, e := range list.Items {
+		metas = append(metas, e.ObjectMeta)
+	}
+	return metas, list.ListMeta, nil
+}
+
+func (eventGenerator) Watch(ctx context.Context, clientset kubernetes.Interface, ns string, opts metav1.ListOptions) (watch.Interface, error) {
+	return clientset.CoreV1().Events(ns).Watch(ctx, opts)
+}
+
+func (eventGenerator) Delete(ctx context.Context, clientset kubernetes.Interface, ns string, name string, opts metav1.DeleteOptions) error {
+	return clientset.CoreV1().Events(ns).Delete(ctx, name, opts)
+}
+
+func (eventGenerator) DeleteCollection(ctx context.Context, clientset kubernetes.Interface, ns string, opts metav1.DeleteOptions, listOpts metav1.ListOptions) error {
+	return clientset.CoreV1().Events(ns).DeleteCollection(ctx, opts, listOpts)
+}
+
+// eventReason is the reason of every generated Event, its payload is the
+// message.
+const eventReason = "CPburnerTest"
+
+func eventOf(obj Object) *apiv1.Event {
+	return &apiv1.Event{
+		ObjectMeta:     obj.Meta,
+		InvolvedObject: obj.InvolvedObject,
+		Reason:         eventReason,
+		Message:        obj.Payload,
+	}
+}
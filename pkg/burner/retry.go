@@ -0,0 +1,64 @@
+package burner
+
+import (
+	"context"
+	"errors"
+	"net"
+	"time"
+
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	utilnet "k8s.io/apimachinery/pkg/util/net"
+)
+
+const (
+	// attempts Retry makes before it gives up on a transient failure
+	retryAttempts = 5
+	// backoff before the second attempt, doubling up to maxRetryBackoff
+	retryBackoff    = time.Second
+	maxRetryBackoff = 30 * time.Second
+)
+
+// IsTransient tells whether err may go away on its own: throttling,
+// timeouts, apiserver and etcd errors and broken connections. Errors like
+// a rejected authentication, which every retry would repeat, are not.
+func IsTransient(err error) bool {
+	if err == nil {
+		return false
+	}
+	switch {
+	case apierrors.IsTooManyRequests(err), apierrors.IsTimeout(err), apierrors.IsServerTimeout(err),
+		apierrors.IsInternalError(err), apierrors.IsServiceUnavailable(err), apierrors.IsUnexpectedServerError(err):
+		return true
+	case apierrors.IsUnauthorized(err), apierrors.IsForbidden(err):
+		return false
+	case utilnet.IsProbableEOF(err), utilnet.IsConnectionReset(err), utilnet.IsConnectionRefused(err):
+		return true
+	}
+	var netErr net.Error
+	if errors.As(err, &netErr) {
+		return true
+	}
+	var status apierrors.APIStatus
+	return errors.As(err, &status) && status.Status().Code >= 500
+}
+
+// Retry calls f until it succeeds, fails with an error that is not
+// transient, fails retryAttempts times or ctx is done, backing off between
+// attempts. It returns the last error of f.
+func Retry(ctx context.Context, f func() error) error {
+	backoff := retryBackoff
+	for attempt := 1; ; attempt++ {
+		err := f()
+		if err == nil || !IsTransient(err) || attempt == retryAttempts {
+			return err
+		}
+		select {
+		case <-ctx.Done():
+			return err
+		case <-time.After(backoff):
+		}
+		if backoff *= 2; backoff > maxRetryBackoff {
+			backoff = maxRetryBackoff
+		}
+	}
+}
@@ -0,0 +1,60 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"sync"
+	"time"
+
+	"k8s.io/client-go/kubernetes"
+	"k8s.io/client-go/rest"
+)
+
+const actionRelist = "relist"
+
+// relistStorm has every worker list all objects of the target namespaces at
+// once, unpaginated, the way controllers relist when they restart after an
+// apiserver rollout. It repeats that -storms times, -stormInterval apart, and
+// reports how long every storm took to be absorbed. Responses are decoded
+// as a stream whatever -listDecode, so that the apiserver runs out of memory
+// before cpburner does; -listDecode metadata asks for metadata only.
+func relistStorm(config *rest.Config, resourceType string) {
+	ctx := context.Background()
+	clientsets := make([]*kubernetes.Clientset, concurrency)
+	for i := range clientsets {
+		clientset, err := kubernetes.NewForConfig(workerConfig(config))
+		if err != nil {
+			panic(err)
+		}
+		clientsets[i] = clientset
+	}
+	resource := resourceName(resourceType)
+	for storm := 1; storms == 0 || storm <= storms; storm++ {
+		if storm > 1 {
+			time.Sleep(stormInterval)
+		}
+		if stopRequested() || (duration > 0 && !time.Now().Before(deadline)) {
+			return
+		}
+		stats := &latencyStats{}
+		fire := make(chan struct{})
+		wg := sync.WaitGroup{}
+		for _, clientset := range clientsets {
+			wg.Add(1)
+			go func(clientset *kubernetes.Clientset) {
+				defer wg.Done()
+				<-fire
+				for _, ns := range targetNamespaces() {
+					start := time.Now()
+					_, err := streamListPage(ctx, clientset, ns, resource, "", 0)
+					record(verbList, resource, start, err)
+					stats.observe(time.Since(start), err)
+				}
+			}(clientset)
+		}
+		start := time.Now()
+		close(fire)
+		wg.Wait()
+		fmt.Fprintf(out, "relist storm %d: %d workers relisted in %s, lists: %s\n", storm, concurrency, time.Since(start).Round(time.Millisecond), stats)
+	}
+}
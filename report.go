@@ -0,0 +1,515 @@
+package main
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"encoding/json"
+	"flag"
+	"fmt"
+	"os"
+	"sort"
+	"strings"
+	"sync/atomic"
+	"time"
+
+	apiv1 "k8s.io/api/core/v1"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"k8s.io/apimachinery/pkg/runtime/schema"
+	"k8s.io/client-go/dynamic"
+	"k8s.io/client-go/kubernetes"
+	"k8s.io/client-go/rest"
+)
+
+const flowControlGroup = "flowcontrol.apiserver.k8s.io"
+
+// resultLabel marks the ConfigMaps holding run reports, its value is the
+// action of the run.
+const resultLabel = "cpburner/result"
+
+// aggregateLabel groups the stored reports of replicas running the same
+// load, its value is -aggregateRun.
+const aggregateLabel = "cpburner/aggregate"
+
+// name of the aggregate the report of this run belongs to, -aggregateRun
+var aggregateRun string
+
+// runReport describes a run well enough to interpret its results later.
+type runReport struct {
+	SchemaVersion int       `json:"schemaVersion"`
+	RunPrefix     string    `json:"runPrefix"`
+	StartTime     time.Time `json:"startTime"`
+	EndTime       time.Time `json:"endTime"`
+	Action        string    `json:"action"`
+	ResourceType  string    `json:"resourceType"`
+	// every flag of the run, defaults included
+	Parameters map[string]string `json:"parameters,omitempty"`
+	Cluster    *clusterInventory `json:"cluster,omitempty"`
+	Totals     *runTotals        `json:"totals,omitempty"`
+	// failed requests by HTTP code, "error" for those that got no response
+	Errors map[string]int64 `json:"errors,omitempty"`
+	// failed requests by class, e.g. "throttled" or "timeout"
+	ErrorClasses map[string]int64          `json:"errorClasses,omitempty"`
+	Latencies    map[string]latencySummary `json:"latencies,omitempty"`
+	// the histograms behind Latencies, so reports can be merged
+	Histograms map[string]histogramSnapshot `json:"histograms,omitempty"`
+	// run prefixes of the reports an aggregate report was merged from
+	Replicas []string `json:"replicas,omitempty"`
+	// where API Priority and Fairness classified the requests
+	APF []apfUsage `json:"apf,omitempty"`
+	// 429 responses including retried ones, and the delays they advised
+	Throttled  int64           `json:"throttled"`
+	RetryAfter *latencySummary `json:"retryAfter,omitempty"`
+	Workers    []workerSummary `json:"workers,omitempty"`
+	// events every watcher of 'watch' received
+	Watchers  []watcherSummary `json:"watchers,omitempty"`
+	Informers *informerSummary `json:"informers,omitempty"`
+	Bookmarks *bookmarkSummary `json:"bookmarks,omitempty"`
+	// whole-list times of -listMethod compare
+	ListComparison *listComparison `json:"listComparison,omitempty"`
+	Checks         []checkResult   `json:"checks,omitempty"`
+}
+
+type runTotals struct {
+	Success     int64 `json:"success"`
+	Failure     int64 `json:"failure"`
+	Oversized   int64 `json:"oversized"`
+	WatchEvents int64 `json:"watchEvents"`
+	Warmup      int64 `json:"warmup"`
+}
+
+func currentTotals() *runTotals {
+	return &runTotals{
+		Success:     atomic.LoadInt64(&counterSuccess),
+		Failure:     atomic.LoadInt64(&counterFailure),
+		Oversized:   atomic.LoadInt64(&counterOversized),
+		WatchEvents: atomic.LoadInt64(&counterWatchEvents),
+		Warmup:      atomic.LoadInt64(&counterWarmup),
+	}
+}
+
+// latencySummary is a histogram in seconds.
+type latencySummary struct {
+	Count int64   `json:"count"`
+	Min   float64 `json:"min"`
+	Mean  float64 `json:"mean"`
+	P50   float64 `json:"p50"`
+	P90   float64 `json:"p90"`
+	P99   float64 `json:"p99"`
+	P999  float64 `json:"p999"`
+	Max   float64 `json:"max"`
+}
+
+type clusterInventory struct {
+	ServerVersion  string              `json:"serverVersion"`
+	Nodes          int                 `json:"nodes"`
+	Apiservers     int                 `json:"apiservers"`
+	FeatureGates   map[string]bool     `json:"featureGates,omitempty"`
+	FlowSchemas    []flowSchemaInfo    `json:"flowSchemas,omitempty"`
+	PriorityLevels []priorityLevelInfo `json:"priorityLevels,omitempty"`
+	// parts of the inventory that could not be read, e.g. for lack of RBAC
+	Errors []string `json:"errors,omitempty"`
+}
+
+type flowSchemaInfo struct {
+	Name                string `json:"name"`
+	UID                 string `json:"uid"`
+	PriorityLevel       string `json:"priorityLevel"`
+	MatchingPrecedence  int64  `json:"matchingPrecedence"`
+	DistinguisherMethod string `json:"distinguisherMethod,omitempty"`
+}
+
+type priorityLevelInfo struct {
+	Name                     string `json:"name"`
+	UID                      string `json:"uid"`
+	Type                     string `json:"type"`
+	AssuredConcurrencyShares int64  `json:"assuredConcurrencyShares,omitempty"`
+}
+
+var report runReport
+
+// writeReport completes report with the results so far and writes it to
+// outputJSON, outputJUnit and into a ConfigMap in resultsNamespace, if set.
+func writeReport(config *rest.Config) {
+	if outputJSON == "" && outputJUnit == "" && resultsNamespace == "" {
+		return
+	}
+	report.EndTime = time.Now()
+	report.Parameters = map[string]string{}
+	flag.VisitAll(func(f *flag.Flag) {
+		report.Parameters[f.Name] = f.Value.String()
+	})
+	report.Totals = currentTotals()
+	report.Errors, report.ErrorClasses = errorCounts()
+	report.Latencies = latencySummaries()
+	report.Histograms = latencySnapshots()
+	report.APF = apfUsages()
+	report.Throttled = atomic.LoadInt64(&counterThrottled)
+	if report.Throttled > 0 {
+		s := retryAfter.summary()
+		report.RetryAfter = &s
+	}
+	report.Workers = workerSummaries()
+	report.Watchers = watcherSummaries()
+	report.Informers = informerSummaries()
+	report.Bookmarks = bookmarkSummaries()
+	report.ListComparison = listComparisons()
+	data, err := json.MarshalIndent(report, "", "  ")
+	if err != nil {
+		panic(err)
+	}
+	if outputJSON != "" {
+		if err := os.WriteFile(outputJSON, append(data, '\n'), 0644); err != nil {
+			fmt.Fprintf(out, "failed to write %s: %s\n", outputJSON, err)
+		}
+	}
+	if outputJUnit != "" {
+		if err := writeJUnit(outputJUnit); err != nil {
+			fmt.Fprintf(out, "failed to write %s: %s\n", outputJUnit, err)
+		}
+	}
+	if resultsNamespace != "" {
+		if err := storeReport(config, data); err != nil {
+			fmt.Fprintf(out, "failed to store the report in namespace %s: %s\n", resultsNamespace, err)
+		}
+	}
+}
+
+// storeReport keeps the report in a ConfigMap named after the run, so the
+// results of in-cluster runs outlive their pods.
+func storeReport(config *rest.Config, data []byte) error {
+	ctx := context.Background()
+	clientset, err := kubernetes.NewForConfig(config)
+	if err != nil {
+		return err
+	}
+	// not labelled as a run, 'clean' must not take the reports with it
+	if err := ensureNamespace(ctx, clientset, resultsNamespace, nil); err != nil {
+		return err
+	}
+	cm := &apiv1.ConfigMap{
+		ObjectMeta: metav1.ObjectMeta{
+			Name:   "cpburner-result-" + globalPrefix,
+			Labels: map[string]string{resultLabel: report.Action},
+		},
+		Data: map[string]string{"report.json": string(data)},
+	}
+	if aggregateRun != "" {
+		cm.Labels[aggregateLabel] = aggregateRun
+	}
+	_, err = clientset.CoreV1().ConfigMaps(resultsNamespace).Create(ctx, cm, metav1.CreateOptions{})
+	if apierrors.IsAlreadyExists(err) {
+		_, err = clientset.CoreV1().ConfigMaps(resultsNamespace).Update(ctx, cm, metav1.UpdateOptions{})
+	}
+	if err == nil {
+		fmt.Fprintf(out, "report stored in configmap %s/%s\n", resultsNamespace, cm.Name)
+	}
+	return err
+}
+
+// decodeReport reads back a stored report, see schemaVersion for the
+// versions it takes.
+func decodeReport(data string) (runReport, error) {
+	r := runReport{}
+	if err := json.Unmarshal([]byte(data), &r); err != nil {
+		return r, err
+	}
+	if r.SchemaVersion > schemaVersion {
+		return r, fmt.Errorf("schema version %d is newer than %d, it needs a newer cpburner", r.SchemaVersion, schemaVersion)
+	}
+	if r.SchemaVersion == 0 {
+		r.SchemaVersion = 1
+	}
+	return r, nil
+}
+
+// printStoredReports prints a line for every report stored in
+// resultsNamespace, oldest first, starting with the run prefix.
+func printStoredReports(config *rest.Config) {
+	clientset, err := kubernetes.NewForConfig(config)
+	if err != nil {
+		panic(err)
+	}
+	cms, err := clientset.CoreV1().ConfigMaps(resultsNamespace).List(context.Background(), metav1.ListOptions{LabelSelector: resultLabel})
+	if err != nil {
+		panic(err)
+	}
+	// reports by run prefix
+	reports := map[string]runReport{}
+	prefixes := []string{}
+	for _, cm := range cms.Items {
+		r, err := decodeReport(cm.Data["report.json"])
+		if err != nil {
+			fmt.Fprintf(out, "skipping configmap %s: %s\n", cm.Name, err)
+			continue
+		}
+		prefix := strings.TrimPrefix(cm.Name, "cpburner-result-")
+		reports[prefix] = r
+		prefixes = append(prefixes, prefix)
+	}
+	sort.Slice(prefixes, func(i, j int) bool {
+		return reports[prefixes[i]].StartTime.Before(reports[prefixes[j]].StartTime)
+	})
+	for _, prefix := range prefixes {
+		r := reports[prefix]
+		fmt.Fprintf(out, "%s %s %s %s, ran %s", prefix, r.StartTime.Format(time.RFC3339), r.Action, r.ResourceType, r.EndTime.Sub(r.StartTime).Round(time.Second))
+		if r.Totals != nil {
+			fmt.Fprintf(out, ", success: %d, failure: %d", r.Totals.Success, r.Totals.Failure)
+		}
+		for _, c := range r.Checks {
+			if !c.Passed {
+				fmt.Fprintf(out, ", failed %s", c.Name)
+			}
+		}
+		fmt.Fprintln(out)
+	}
+}
+
+// printAggregateReport merges the reports stored in resultsNamespace by the
+// replicas of -aggregateRun into one, prints it, and writes it to outputJSON
+// if set. Totals and errors are summed up and the latency percentiles
+// computed from the merged histograms.
+func printAggregateReport(config *rest.Config) {
+	clientset, err := kubernetes.NewForConfig(config)
+	if err != nil {
+		panic(err)
+	}
+	cms, err := clientset.CoreV1().ConfigMaps(resultsNamespace).List(context.Background(), metav1.ListOptions{LabelSelector: aggregateLabel + "=" + aggregateRun})
+	if err != nil {
+		panic(err)
+	}
+	merged := runReport{SchemaVersion: schemaVersion, RunPrefix: aggregateRun, Totals: &runTotals{}, Errors: map[string]int64{}, ErrorClasses: map[string]int64{}}
+	histograms := map[string]*histogram{}
+	for _, cm := range cms.Items {
+		r, err := decodeReport(cm.Data["report.json"])
+		if err != nil {
+			fmt.Fprintf(out, "skipping configmap %s: %s\n", cm.Name, err)
+			continue
+		}
+		merged.Replicas = append(merged.Replicas, r.RunPrefix)
+		if merged.StartTime.IsZero() || r.StartTime.Before(merged.StartTime) {
+			merged.StartTime = r.StartTime
+		}
+		if r.EndTime.After(merged.EndTime) {
+			merged.EndTime = r.EndTime
+		}
+		merged.Action, merged.ResourceType = r.Action, r.ResourceType
+		if r.Totals != nil {
+			merged.Totals.Success += r.Totals.Success
+			merged.Totals.Failure += r.Totals.Failure
+			merged.Totals.Oversized += r.Totals.Oversized
+			merged.Totals.WatchEvents += r.Totals.WatchEvents
+			merged.Totals.Warmup += r.Totals.Warmup
+		}
+		for code, n := range r.Errors {
+			merged.Errors[code] += n
+		}
+		for class, n := range r.ErrorClasses {
+			merged.ErrorClasses[class] += n
+		}
+		merged.Throttled += r.Throttled
+		for verb, s := range r.Histograms {
+			if histograms[verb] == nil {
+				histograms[verb] = &histogram{}
+			}
+			histograms[verb].add(s)
+		}
+		for _, c := range r.Checks {
+			c.Name = r.RunPrefix + " " + c.Name
+			merged.Checks = append(merged.Checks, c)
+		}
+	}
+	if len(merged.Replicas) == 0 {
+		fmt.Fprintf(out, "no reports of %s stored in namespace %s\n", aggregateRun, resultsNamespace)
+		os.Exit(1)
+	}
+	sort.Strings(merged.Replicas)
+	merged.Latencies = map[string]latencySummary{}
+	merged.Histograms = map[string]histogramSnapshot{}
+	for verb, h := range histograms {
+		merged.Latencies[verb] = h.summary()
+		merged.Histograms[verb] = h.snapshot()
+	}
+
+	fmt.Fprintf(out, "%s: %d replicas, %s %s, ran %s, success: %d, failure: %d, oversized: %d\n", aggregateRun, len(merged.Replicas),
+		merged.Action, merged.ResourceType, merged.EndTime.Sub(merged.StartTime).Round(time.Second), merged.Totals.Success, merged.Totals.Failure, merged.Totals.Oversized)
+	verbs := []string{}
+	for verb := range histograms {
+		verbs = append(verbs, verb)
+	}
+	sort.Strings(verbs)
+	for _, verb := range verbs {
+		fmt.Fprintf(out, "  %s latency: %s\n", verb, histograms[verb])
+	}
+	for _, c := range merged.Checks {
+		if !c.Passed {
+			fmt.Fprintf(out, "  failed %s\n", c.Name)
+		}
+	}
+	if outputJSON != "" {
+		data, err := json.MarshalIndent(merged, "", "  ")
+		if err != nil {
+			panic(err)
+		}
+		if err := os.WriteFile(outputJSON, append(data, '\n'), 0644); err != nil {
+			fmt.Fprintf(out, "failed to write %s: %s\n", outputJSON, err)
+		}
+	}
+}
+
+// collectInventory records what the cluster under test looks like. Failing
+// to read any part of it is noted in the inventory rather than fatal.
+func collectInventory(ctx context.Context, config *rest.Config) *clusterInventory {
+	inv := &clusterInventory{}
+	clientset, err := kubernetes.NewForConfig(config)
+	if err != nil {
+		panic(err)
+	}
+	if v, err := clientset.Discovery().ServerVersion(); err != nil {
+		inv.Errors = append(inv.Errors, fmt.Sprintf("server version: %s", err))
+	} else {
+		inv.ServerVersion = v.GitVersion
+	}
+
+	opts := metav1.ListOptions{TimeoutSeconds: &timeout, Limit: listLimit}
+	for {
+		nodes, err := clientset.CoreV1().Nodes().List(ctx, opts)
+		if err != nil {
+			inv.Errors = append(inv.Errors, fmt.Sprintf("nodes: %s", err))
+			break
+		}
+		inv.Nodes += len(nodes.Items)
+		if nodes.Continue == "" {
+			break
+		}
+		opts.Continue = nodes.Continue
+	}
+
+	if endpoints, err := clientset.CoreV1().Endpoints(apiv1.NamespaceDefault).Get(ctx, "kubernetes", metav1.GetOptions{}); err != nil {
+		inv.Errors = append(inv.Errors, fmt.Sprintf("apiservers: %s", err))
+	} else {
+		for _, subset := range endpoints.Subsets {
+			inv.Apiservers += len(subset.Addresses)
+		}
+	}
+
+	if gates, err := featureGates(ctx, clientset); err != nil {
+		inv.Errors = append(inv.Errors, fmt.Sprintf("feature gates: %s", err))
+	} else {
+		inv.FeatureGates = gates
+	}
+
+	if err := collectFlowControl(ctx, config, clientset, inv); err != nil {
+		inv.Errors = append(inv.Errors, fmt.Sprintf("flow control: %s", err))
+	}
+	return inv
+}
+
+// featureGates reads the kubernetes_feature_enabled metric, which apiservers
+// expose since 1.26.
+func featureGates(ctx context.Context, clientset *kubernetes.Clientset) (map[string]bool, error) {
+	body, err := clientset.CoreV1().RESTClient().Get().AbsPath("/metrics").DoRaw(ctx)
+	if err != nil {
+		return nil, err
+	}
+	gates := map[string]bool{}
+	scanner := bufio.NewScanner(bytes.NewReader(body))
+	scanner.Buffer(make([]byte, 64*1024), 1024*1024)
+	for scanner.Scan() {
+		line := scanner.Text()
+		if !strings.HasPrefix(line, "kubernetes_feature_enabled{") {
+			continue
+		}
+		start := strings.Index(line, `name="`)
+		if start < 0 {
+			continue
+		}
+		name := line[start+len(`name="`):]
+		end := strings.Index(name, `"`)
+		if end < 0 {
+			continue
+		}
+		gates[name[:end]] = strings.HasSuffix(line, " 1")
+	}
+	if len(gates) == 0 {
+		return nil, fmt.Errorf("kubernetes_feature_enabled metric not exposed")
+	}
+	return gates, scanner.Err()
+}
+
+// collectFlowControl reads the APF configuration through whichever
+// flowcontrol version the server prefers, so it works across releases.
+func collectFlowControl(ctx context.Context, config *rest.Config, clientset *kubernetes.Clientset, inv *clusterInventory) error {
+	groups, err := clientset.Discovery().ServerGroups()
+	if err != nil {
+		return err
+	}
+	version := ""
+	for _, g := range groups.Groups {
+		if g.Name == flowControlGroup {
+			version = g.PreferredVersion.Version
+		}
+	}
+	if version == "" {
+		return fmt.Errorf("%s is not served", flowControlGroup)
+	}
+	client, err := dynamic.NewForConfig(config)
+	if err != nil {
+		return err
+	}
+
+	schemas, err := client.Resource(schema.GroupVersionResource{Group: flowControlGroup, Version: version, Resource: "flowschemas"}).List(ctx, metav1.ListOptions{})
+	if err != nil {
+		return err
+	}
+	for _, fs := range schemas.Items {
+		info := flowSchemaInfo{Name: fs.GetName(), UID: string(fs.GetUID())}
+		info.PriorityLevel, _, _ = unstructured.NestedString(fs.Object, "spec", "priorityLevelConfiguration", "name")
+		info.MatchingPrecedence, _, _ = unstructured.NestedInt64(fs.Object, "spec", "matchingPrecedence")
+		info.DistinguisherMethod, _, _ = unstructured.NestedString(fs.Object, "spec", "distinguisherMethod", "type")
+		inv.FlowSchemas = append(inv.FlowSchemas, info)
+	}
+	sort.Slice(inv.FlowSchemas, func(i, j int) bool {
+		return inv.FlowSchemas[i].MatchingPrecedence < inv.FlowSchemas[j].MatchingPrecedence
+	})
+
+	levels, err := client.Resource(schema.GroupVersionResource{Group: flowControlGroup, Version: version, Resource: "prioritylevelconfigurations"}).List(ctx, metav1.ListOptions{})
+	if err != nil {
+		return err
+	}
+	for _, pl := range levels.Items {
+		info := priorityLevelInfo{Name: pl.GetName(), UID: string(pl.GetUID())}
+		info.Type, _, _ = unstructured.NestedString(pl.Object, "spec", "type")
+		// renamed to nominalConcurrencyShares in v1beta3
+		for _, field := range []string{"assuredConcurrencyShares", "nominalConcurrencyShares"} {
+			if shares, found, _ := unstructured.NestedInt64(pl.Object, "spec", "limited", field); found {
+				info.AssuredConcurrencyShares = shares
+			}
+		}
+		inv.PriorityLevels = append(inv.PriorityLevels, info)
+	}
+	return nil
+}
+
+func printInventory(inv *clusterInventory) {
+	fmt.Fprintf(out, "cluster: version %s, %d nodes, %d apiservers, %d feature gates enabled, %d flow schemas, %d priority levels\n",
+		inv.ServerVersion, inv.Nodes, inv.Apiservers, countEnabled(inv.FeatureGates), len(inv.FlowSchemas), len(inv.PriorityLevels))
+	for _, pl := range inv.PriorityLevels {
+		fmt.Fprintf(out, "  priority level %s: %s, shares %d\n", pl.Name, pl.Type, pl.AssuredConcurrencyShares)
+	}
+	for _, e := range inv.Errors {
+		fmt.Fprintf(out, "  unavailable: %s\n", e)
+	}
+}
+
+func countEnabled(gates map[string]bool) int {
+	n := 0
+	for _, enabled := range gates {
+		if enabled {
+			n++
+		}
+	}
+	return n
+}
@@ -0,0 +1,130 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"os"
+	"sort"
+	"strconv"
+	"strings"
+
+	"sigs.k8s.io/yaml"
+)
+
+// loadScenario sets the flags named by the top-level keys of a YAML file
+// like
+//
+//	action: mix
+//	resourceType: configmap
+//	namespace: load
+//	payloadSize: 4096
+//	mix: {create: 50, get: 30, list: 20}
+//	phases:
+//	- {qps: 100, duration: 5m}
+//	- {qps: 500, duration: 5m}
+//
+// Maps become comma separated key=value lists and other lists comma
+// separated values, phases become -steps. Flags already set on the command
+// line are left alone.
+func loadScenario(path string) error {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return err
+	}
+	scenario := map[string]interface{}{}
+	if err := yaml.Unmarshal(data, &scenario); err != nil {
+		return err
+	}
+	set := map[string]bool{}
+	flag.Visit(func(f *flag.Flag) {
+		set[f.Name] = true
+	})
+	for key, v := range scenario {
+		name := key
+		if key == "phases" {
+			name = "steps"
+		}
+		if name == "config" || flag.Lookup(name) == nil {
+			return fmt.Errorf("unknown key %q", key)
+		}
+		if set[name] {
+			continue
+		}
+		var value string
+		if key == "phases" {
+			value, err = phasesValue(v)
+		} else {
+			value, err = flagValue(v)
+		}
+		if err != nil {
+			return fmt.Errorf("%s: %w", key, err)
+		}
+		if err := flag.Set(name, value); err != nil {
+			return fmt.Errorf("%s: %w", key, err)
+		}
+	}
+	return nil
+}
+
+// flagValue is the command line form of a scenario value.
+func flagValue(v interface{}) (string, error) {
+	switch v := v.(type) {
+	case string:
+		return v, nil
+	case bool:
+		return strconv.FormatBool(v), nil
+	case float64:
+		return strconv.FormatFloat(v, 'f', -1, 64), nil
+	case []interface{}:
+		values := []string{}
+		for _, e := range v {
+			value, err := flagValue(e)
+			if err != nil {
+				return "", err
+			}
+			values = append(values, value)
+		}
+		return strings.Join(values, ","), nil
+	case map[string]interface{}:
+		keys := []string{}
+		for k := range v {
+			keys = append(keys, k)
+		}
+		sort.Strings(keys)
+		values := []string{}
+		for _, k := range keys {
+			value, err := flagValue(v[k])
+			if err != nil {
+				return "", err
+			}
+			values = append(values, k+"="+value)
+		}
+		return strings.Join(values, ","), nil
+	}
+	return "", fmt.Errorf("unsupported value %v", v)
+}
+
+// phasesValue turns a list of phases into a -steps profile.
+func phasesValue(v interface{}) (string, error) {
+	phases, ok := v.([]interface{})
+	if !ok {
+		return "", fmt.Errorf("phases need to be a list")
+	}
+	values := []string{}
+	for _, p := range phases {
+		phase, ok := p.(map[string]interface{})
+		if !ok {
+			return "", fmt.Errorf("invalid phase %v", p)
+		}
+		qps, err := flagValue(phase["qps"])
+		if err != nil {
+			return "", err
+		}
+		d, err := flagValue(phase["duration"])
+		if err != nil {
+			return "", err
+		}
+		values = append(values, qps+"qps:"+d)
+	}
+	return strings.Join(values, ","), nil
+}
@@ -0,0 +1,76 @@
+package main
+
+import (
+	"fmt"
+	"os"
+	"os/signal"
+	"sync"
+	"sync/atomic"
+	"syscall"
+	"time"
+
+	"k8s.io/client-go/rest"
+)
+
+const shutdownCheck = "shutdown"
+
+var (
+	// how long requests in flight may drain after a signal, -shutdownTimeout
+	shutdownTimeout time.Duration
+	// whether to run 'clean' after a signal, -cleanOnInterrupt
+	cleanOnInterrupt bool
+	// name of the signal that stopped the run, unset until one arrives
+	interruptedBy atomic.Value
+	// held by whoever reports the end of the run
+	finishing sync.Mutex
+)
+
+// handleSignals stops the run on the first SIGINT or SIGTERM and lets the
+// requests in flight drain, main then reports the run as usual. A run that
+// does not drain within shutdownTimeout is reported and ended from here, a
+// second signal ends it right away without a report.
+func handleSignals(config *rest.Config, resourceType string) {
+	signals := make(chan os.Signal, 2)
+	signal.Notify(signals, syscall.SIGINT, syscall.SIGTERM)
+	go func() {
+		name := signalName(<-signals)
+		interruptedBy.Store(name)
+		fmt.Fprintf(out, "received %s, waiting up to %s for the requests in flight\n", name, shutdownTimeout)
+		requestStop()
+		select {
+		case sig := <-signals:
+			fmt.Fprintf(out, "received %s again, exiting\n", signalName(sig))
+			sendFinalStats(false)
+			os.Exit(1)
+		case <-time.After(shutdownTimeout):
+		}
+		finishing.Lock()
+		fmt.Fprintf(out, "requests still in flight after %s, exiting\n", shutdownTimeout)
+		addInterruptCheck()
+		sendFinalStats(false)
+		showStatus()
+		writeReport(config)
+		if cleanOnInterrupt {
+			cleanRun(config, resourceType)
+		}
+		runPostRunHook(false)
+		os.Exit(1)
+	}()
+}
+
+func signalName(sig os.Signal) string {
+	if sig == syscall.SIGINT {
+		return "SIGINT"
+	}
+	return "SIGTERM"
+}
+
+// addInterruptCheck fails the shutdown check of a run a signal stopped, it
+// returns whether one did.
+func addInterruptCheck() bool {
+	sig, ok := interruptedBy.Load().(string)
+	if ok {
+		addCheck(shutdownCheck, false, "interrupted by "+sig)
+	}
+	return ok
+}
@@ -0,0 +1,112 @@
+package main
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+	"sync/atomic"
+	"time"
+)
+
+// slo is one threshold of -slo. Latency objectives apply to the requests
+// of verb, or to all requests when verb is empty.
+type slo struct {
+	spec     string
+	verb     string
+	quantile float64 // for latency, 0 means the mean
+	latency  time.Duration
+	// maximum percentage of failed requests, used when isErrorRate
+	errorRate   float64
+	isErrorRate bool
+}
+
+// parseSLOs parses objectives like "p99-latency=1s,create:p50-latency=100ms,error-rate=1%".
+func parseSLOs(s string) ([]slo, error) {
+	if s == "" {
+		return nil, nil
+	}
+	slos := []slo{}
+	for _, part := range strings.Split(s, ",") {
+		part = strings.TrimSpace(part)
+		key, value, ok := strings.Cut(part, "=")
+		if !ok {
+			return nil, fmt.Errorf("invalid slo %q", part)
+		}
+		o := slo{spec: part}
+		if verb, rest, ok := strings.Cut(key, ":"); ok {
+			o.verb, key = verb, rest
+		}
+		if key == "error-rate" {
+			rate, err := strconv.ParseFloat(strings.TrimSuffix(value, "%"), 64)
+			if err != nil || rate < 0 || o.verb != "" {
+				return nil, fmt.Errorf("invalid slo %q", part)
+			}
+			o.errorRate, o.isErrorRate = rate, true
+			slos = append(slos, o)
+			continue
+		}
+		switch key {
+		case "mean-latency":
+		case "p50-latency":
+			o.quantile = 0.5
+		case "p90-latency":
+			o.quantile = 0.9
+		case "p99-latency":
+			o.quantile = 0.99
+		case "p999-latency":
+			o.quantile = 0.999
+		default:
+			return nil, fmt.Errorf("unknown slo %q", key)
+		}
+		d, err := time.ParseDuration(value)
+		if err != nil {
+			return nil, fmt.Errorf("invalid slo %q", part)
+		}
+		o.latency = d
+		slos = append(slos, o)
+	}
+	return slos, nil
+}
+
+// checkSLOs adds a check for every objective and tells whether all of them
+// were met.
+func checkSLOs(slos []slo) bool {
+	met := true
+	for _, o := range slos {
+		var passed bool
+		var measured string
+		if o.isErrorRate {
+			failures := atomic.LoadInt64(&counterFailure)
+			requests := atomic.LoadInt64(&counterSuccess) + failures + atomic.LoadInt64(&counterOversized)
+			rate := 0.0
+			if requests > 0 {
+				rate = float64(failures) * 100 / float64(requests)
+			}
+			passed, measured = rate <= o.errorRate, fmt.Sprintf("%.2f%%", rate)
+		} else {
+			h := &allLatencies
+			if o.verb != "" {
+				latencyMu.Lock()
+				h = latencies[o.verb]
+				latencyMu.Unlock()
+			}
+			if h == nil {
+				addCheck("slo "+o.spec, false, "no "+o.verb+" requests")
+				met = false
+				continue
+			}
+			d := h.mean()
+			if o.quantile > 0 {
+				d = h.percentile(o.quantile)
+			}
+			passed, measured = d <= o.latency, round(d).String()
+		}
+		msg := "measured " + measured
+		if !passed {
+			met = false
+			fmt.Fprintf(out, "slo %s violated, %s\n", o.spec, msg)
+		}
+		addCheck("slo "+o.spec, passed, msg)
+	}
+	return met
+}
@@ -0,0 +1,282 @@
+package main
+
+import (
+	"context"
+	"encoding/csv"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"os"
+	"strconv"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"cpburner/pkg/burner"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+)
+
+// verbs in the apiserver's terms, used to label recorded requests
+const (
+	verbCreate           = "create"
+	verbGet              = "get"
+	verbList             = "list"
+	verbUpdate           = "update"
+	verbPatch            = "patch"
+	verbApply            = "apply"
+	verbDelete           = "delete"
+	verbDeleteCollection = "deletecollection"
+	verbWatch            = "watch"
+)
+
+// schemaVersion is embedded in every JSON document cpburner writes. It is
+// bumped only for changes that can break a reader: removing, renaming or
+// changing the meaning of a field. Adding fields does not bump it, so
+// readers must ignore fields they do not know. cpburner reads back the
+// reports it stored: it rejects those of a newer schema and takes those
+// without a version, written before the field existed, as version 1.
+const schemaVersion = 1
+
+const (
+	outputStreamRequests = "requests"
+	outputStreamStatus   = "status"
+)
+
+// out receives all human readable output. It is stderr when -outputStream
+// takes stdout for NDJSON.
+var out io.Writer = os.Stdout
+
+var (
+	streamMu      sync.Mutex
+	streamEncoder = json.NewEncoder(os.Stdout)
+)
+
+type requestRecord struct {
+	SchemaVersion int       `json:"schemaVersion"`
+	Time          time.Time `json:"time"`
+	Verb          string    `json:"verb"`
+	Resource      string    `json:"resource"`
+	Duration      float64   `json:"duration"`
+	Code          int32     `json:"code,omitempty"`
+	Error         string    `json:"error,omitempty"`
+}
+
+type statusRecord struct {
+	SchemaVersion int       `json:"schemaVersion"`
+	Time          time.Time `json:"time"`
+	Elapsed       float64   `json:"elapsed"`
+	Success       int64     `json:"success"`
+	Failure       int64     `json:"failure"`
+	Oversized     int64     `json:"oversized"`
+	WatchEvents   int64     `json:"watchEvents"`
+}
+
+// record accounts one finished request that started at start. Every request
+// cpburner issues goes through here. Lists abandoned for exceeding
+// -maxListResponseBytes are counted as oversized rather than failed.
+func record(verb string, resource string, start time.Time, err error) {
+	if warmingUp() {
+		atomic.AddInt64(&counterWarmup, 1)
+		return
+	}
+	if errors.Is(err, errResponseTooLarge) {
+		atomic.AddInt64(&counterOversized, 1)
+	} else if err != nil {
+		atomic.AddInt64(&counterFailure, 1)
+	} else {
+		atomic.AddInt64(&counterSuccess, 1)
+	}
+	now := time.Now()
+	atomic.AddInt64(&counterLatency, int64(now.Sub(start)))
+	observeLatency(verb, now.Sub(start))
+	var code int32
+	var status apierrors.APIStatus
+	if errors.As(err, &status) {
+		code = status.Status().Code
+	}
+	observeRequestMetric(verb, resource, code, err, now.Sub(start))
+	if err != nil && !errors.Is(err, errResponseTooLarge) {
+		countError(codeLabel(code, err), errorClass(err))
+	}
+	if outputStream != outputStreamRequests && requestLog == nil {
+		return
+	}
+	r := requestRecord{SchemaVersion: schemaVersion, Time: now, Verb: verb, Resource: resource, Duration: now.Sub(start).Seconds(), Code: code}
+	if err != nil {
+		r.Error = err.Error()
+	}
+	if outputStream == outputStreamRequests {
+		emit(r)
+	}
+	if requestLog != nil {
+		requestLog.write(r)
+	}
+}
+
+// requestLogFile writes one line per request to -requestLog, as CSV if the
+// file name ends in .csv and as NDJSON otherwise. Lines are not buffered so
+// nothing is lost when the run exits early.
+type requestLogFile struct {
+	mu      sync.Mutex
+	csv     *csv.Writer
+	encoder *json.Encoder
+}
+
+var requestLog *requestLogFile
+
+func openRequestLog(path string) (*requestLogFile, error) {
+	f, err := os.Create(path)
+	if err != nil {
+		return nil, err
+	}
+	if !strings.HasSuffix(path, ".csv") {
+		return &requestLogFile{encoder: json.NewEncoder(f)}, nil
+	}
+	l := &requestLogFile{csv: csv.NewWriter(f)}
+	l.csv.Write([]string{"time", "verb", "resource", "duration", "code", "error"})
+	l.csv.Flush()
+	return l, l.csv.Error()
+}
+
+func (l *requestLogFile) write(r requestRecord) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	if l.encoder != nil {
+		l.encoder.Encode(r)
+		return
+	}
+	code := ""
+	if r.Code > 0 {
+		code = strconv.Itoa(int(r.Code))
+	}
+	l.csv.Write([]string{r.Time.Format(time.RFC3339Nano), r.Verb, r.Resource,
+		formatFloat(r.Duration), code, r.Error})
+	l.csv.Flush()
+}
+
+// recordWatchEvent accounts one non-bookmark event received by a watch.
+func recordWatchEvent() {
+	if warmingUp() {
+		return
+	}
+	atomic.AddInt64(&counterWatchEvents, 1)
+	watchEventsMetric.Inc()
+}
+
+func recordStatus() {
+	if outputStream != outputStreamStatus {
+		return
+	}
+	emit(statusRecord{
+		SchemaVersion: schemaVersion,
+		Time:          time.Now(),
+		Elapsed:       time.Since(report.StartTime).Seconds(),
+		Success:       atomic.LoadInt64(&counterSuccess),
+		Failure:       atomic.LoadInt64(&counterFailure),
+		Oversized:     atomic.LoadInt64(&counterOversized),
+		WatchEvents:   atomic.LoadInt64(&counterWatchEvents),
+	})
+}
+
+func emit(v interface{}) {
+	streamMu.Lock()
+	defer streamMu.Unlock()
+	streamEncoder.Encode(v)
+}
+
+// classes of failed requests
+const (
+	errorClassThrottled = "throttled"
+	errorClassServer    = "server"
+	errorClassTimeout   = "timeout"
+	errorClassConflict  = "conflict"
+	errorClassForbidden = "forbidden"
+	errorClassNetwork   = "network"
+	errorClassOther     = "other"
+)
+
+var (
+	errorsMu sync.Mutex
+	// failed requests by codeLabel
+	errorsByCode = map[string]int64{}
+	// failed requests by errorClass
+	errorsByClass = map[string]int64{}
+)
+
+// errorClass tells apart the failures worth telling apart under load: APF
+// rejections, apiserver and etcd errors, timeouts on either side, conflicts,
+// authorization and the connection itself.
+func errorClass(err error) string {
+	var netErr net.Error
+	switch {
+	case apierrors.IsTooManyRequests(err):
+		return errorClassThrottled
+	case apierrors.IsTimeout(err) || apierrors.IsServerTimeout(err) || errors.Is(err, context.DeadlineExceeded):
+		return errorClassTimeout
+	case apierrors.IsConflict(err):
+		return errorClassConflict
+	case apierrors.IsForbidden(err) || apierrors.IsUnauthorized(err):
+		return errorClassForbidden
+	case apierrors.IsInternalError(err) || apierrors.IsServiceUnavailable(err) || apierrors.IsUnexpectedServerError(err):
+		return errorClassServer
+	case errors.As(err, &netErr):
+		if netErr.Timeout() {
+			return errorClassTimeout
+		}
+		return errorClassNetwork
+	}
+	var status apierrors.APIStatus
+	if errors.As(err, &status) && status.Status().Code >= 500 {
+		return errorClassServer
+	}
+	return errorClassOther
+}
+
+func countError(label string, class string) {
+	errorsMu.Lock()
+	defer errorsMu.Unlock()
+	errorsByCode[label]++
+	errorsByClass[class]++
+}
+
+func errorCounts() (byCode map[string]int64, byClass map[string]int64) {
+	errorsMu.Lock()
+	defer errorsMu.Unlock()
+	byCode, byClass = map[string]int64{}, map[string]int64{}
+	for label, n := range errorsByCode {
+		byCode[label] = n
+	}
+	for class, n := range errorsByClass {
+		byClass[class] = n
+	}
+	return byCode, byClass
+}
+
+// printErrorClasses prints the failures by class, if there are any.
+func printErrorClasses(w io.Writer) {
+	_, byClass := errorCounts()
+	if len(byClass) == 0 {
+		return
+	}
+	parts := []string{}
+	for _, class := range []string{errorClassThrottled, errorClassServer, errorClassTimeout, errorClassConflict, errorClassForbidden, errorClassNetwork, errorClassOther} {
+		if n := byClass[class]; n > 0 {
+			parts = append(parts, fmt.Sprintf("%s %d", class, n))
+		}
+	}
+	fmt.Fprintf(w, "  failures: %s\n", strings.Join(parts, ", "))
+}
+
+// warmingUp tells whether requests finishing now are part of -warmup.
+func warmingUp() bool {
+	return time.Now().Before(warmupEnd)
+}
+
+// resourceName maps -resourceType to the resource name requests are
+// recorded under.
+func resourceName(resourceType string) string {
+	return burner.Generator(resourceType).Spec().Resource
+}
@@ -0,0 +1,95 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"math/rand"
+	"sync"
+	"time"
+
+	apiv1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/types"
+	"k8s.io/client-go/kubernetes"
+	"k8s.io/client-go/rest"
+)
+
+const (
+	// no scheduler serves this name, so generated pods stay pending and
+	// neither a scheduler nor a kubelet ever writes to them
+	podSchedulerName = "cpburner"
+	podImage         = "registry.k8s.io/pause:3.7"
+
+	statusConditionType = "cpburner/heartbeat"
+)
+
+func newPendingPod(name string) *apiv1.Pod {
+	return &apiv1.Pod{
+		ObjectMeta: generatedMeta(name),
+		Spec: apiv1.PodSpec{
+			SchedulerName: podSchedulerName,
+			Containers:    []apiv1.Container{{Name: "pause", Image: podImage}},
+		},
+	}
+}
+
+// statusStorm creates statusObjects pending pods, patches their /status
+// subresource resourceCount times in total from concurrency workers, the way
+// kubelets report pod status, and deletes the pods again. A pod it cannot
+// create ends it, after deleting those it created.
+func statusStorm(config *rest.Config, resourceCount int) error {
+	ctx := context.Background()
+	clientset, err := kubernetes.NewForConfig(config)
+	if err != nil {
+		panic(err)
+	}
+	names := []string{}
+	for i := 0; i < statusObjects; i++ {
+		name := objectName(globalPrefix+"-pod", i)
+		pod, err := clientset.CoreV1().Pods(namespaceOf(name)).Create(ctx, newPendingPod(name), createOptions())
+		if err != nil {
+			deletePods(ctx, clientset, names)
+			return fmt.Errorf("creating pod %s: %w", name, err)
+		}
+		names = append(names, pod.Name)
+	}
+	fmt.Fprintf(out, "created %d pods to update status of\n", len(names))
+
+	wg := sync.WaitGroup{}
+	count := int(resourceCount / concurrency)
+	for i := 0; i < concurrency; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			clientset, err := kubernetes.NewForConfig(workerConfig(config))
+			if err != nil {
+				panic(err)
+			}
+			updatePodStatuses(ctx, clientset, names, count)
+		}()
+	}
+	wg.Wait()
+	deletePods(ctx, clientset, names)
+	return nil
+}
+
+func deletePods(ctx context.Context, clientset *kubernetes.Clientset, names []string) {
+	for _, name := range names {
+		if err := clientset.CoreV1().Pods(namespaceOf(name)).Delete(ctx, name, deleteOptions()); err != nil {
+			fmt.Fprintf(out, "failed to delete pod %s: %s\n", name, err)
+		}
+	}
+}
+
+func updatePodStatuses(ctx context.Context, clientset *kubernetes.Clientset, names []string, count int) {
+	issue(count, func(int) {
+		now := time.Now()
+		patch := fmt.Sprintf(`{"status":{"conditions":[{"type":%q,"status":"True","lastProbeTime":%q,"message":"heartbeat %d"}]}}`,
+			statusConditionType, now.UTC().Format(time.RFC3339), now.UnixNano())
+		start := time.Now()
+		name := names[rand.Intn(len(names))]
+		wctx, cancel := writeContext(ctx)
+		_, err := clientset.CoreV1().Pods(namespaceOf(name)).Patch(wctx, name, types.StrategicMergePatchType, []byte(patch), patchOptions(), "status")
+		cancel()
+		record(verbPatch, "pods/status", start, err)
+	})
+}
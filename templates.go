@@ -0,0 +1,178 @@
+package main
+
+import (
+	"context"
+	"embed"
+	"fmt"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"k8s.io/apimachinery/pkg/runtime/schema"
+	"k8s.io/client-go/dynamic"
+	"k8s.io/client-go/rest"
+	"sigs.k8s.io/yaml"
+)
+
+//go:embed templates/*.yaml
+var templateFiles embed.FS
+
+type objectTemplate struct {
+	file string
+	gvr  schema.GroupVersionResource
+}
+
+// objectTemplates are realistic object shapes that -template can generate
+// instead of the single payload field of -resourceType objects.
+var objectTemplates = map[string]objectTemplate{
+	"deployment":      {file: "templates/deployment.yaml", gvr: schema.GroupVersionResource{Group: "apps", Version: "v1", Resource: "deployments"}},
+	"app-configmap":   {file: "templates/app-configmap.yaml", gvr: schema.GroupVersionResource{Version: "v1", Resource: "configmaps"}},
+	"prometheus-rule": {file: "templates/prometheus-rule.yaml", gvr: schema.GroupVersionResource{Group: "cpburner.io", Version: "v1alpha1", Resource: "burnrules"}},
+}
+
+func templateNames() string {
+	names := []string{}
+	for name := range objectTemplates {
+		names = append(names, "'"+name+"'")
+	}
+	sort.Strings(names)
+	return strings.Join(names, ", ")
+}
+
+func loadTemplate(name string) (*unstructured.Unstructured, error) {
+	t, ok := objectTemplates[name]
+	if !ok {
+		return nil, fmt.Errorf("unknown template %q", name)
+	}
+	data, err := templateFiles.ReadFile(t.file)
+	if err != nil {
+		return nil, err
+	}
+	obj := &unstructured.Unstructured{}
+	if err := yaml.Unmarshal(data, &obj.Object); err != nil {
+		return nil, fmt.Errorf("template %s: %w", name, err)
+	}
+	return obj, nil
+}
+
+// genFromTemplate is gen for -template objects.
+func genFromTemplate(config *rest.Config, resourceCount int, templateName string) {
+	ctx := context.Background()
+	obj, err := loadTemplate(templateName)
+	if err != nil {
+		panic(err)
+	}
+	gvr := objectTemplates[templateName].gvr
+	wg := sync.WaitGroup{}
+	count := int(resourceCount / concurrency)
+	for i := 0; i < concurrency; i++ {
+		wg.Add(1)
+		go func(prefix string) {
+			defer wg.Done()
+			client, err := dynamic.NewForConfig(workerConfig(config))
+			if err != nil {
+				panic(err)
+			}
+			spec := obj.DeepCopy()
+			labels := spec.GetLabels()
+			for k, v := range generatedLabels() {
+				if labels == nil {
+					labels = map[string]string{}
+				}
+				labels[k] = v
+			}
+			spec.SetLabels(labels)
+			annotations := spec.GetAnnotations()
+			if annotations == nil {
+				annotations = map[string]string{}
+			}
+			for k, v := range objectAnnotations {
+				annotations[k] = v
+			}
+			spec.SetAnnotations(annotations)
+			if withFinalizer {
+				spec.SetFinalizers(append(spec.GetFinalizers(), finalizerName))
+			}
+			for j := 0; keepGoing(j, count); j++ {
+				name := objectName(prefix, j)
+				spec.SetName(name)
+				if ttl > 0 {
+					annotations[expiresAnnotation] = expiryOf()
+					spec.SetAnnotations(annotations)
+				}
+				start := time.Now()
+				wctx, cancel := writeContext(ctx)
+				_, err := client.Resource(gvr).Namespace(namespaceOf(name)).Create(wctx, spec, createOptions())
+				cancel()
+				record(verbCreate, gvr.Resource, start, err)
+			}
+		}(fmt.Sprintf("%s-%d", globalPrefix, i))
+	}
+	wg.Wait()
+}
+
+// countTemplateObjectsIn counts the -template objects cpburner generated in
+// ns, those cleanTemplateObjects would delete.
+func countTemplateObjectsIn(ctx context.Context, config *rest.Config, ns string, opts metav1.ListOptions) (int64, error) {
+	client, err := dynamic.NewForConfig(config)
+	if err != nil {
+		panic(err)
+	}
+	resource := client.Resource(objectTemplates[templateName].gvr).Namespace(ns)
+	opts.Limit = listLimit
+	var count int64
+	for {
+		objs, err := resource.List(ctx, opts)
+		if err != nil {
+			return 0, fmt.Errorf("listing the %s of namespace %s: %w", objectTemplates[templateName].gvr.Resource, ns, err)
+		}
+		for _, obj := range objs.Items {
+			if isGenerated(obj.GetName()) {
+				count++
+			}
+		}
+		if objs.GetContinue() == "" {
+			return count, nil
+		}
+		opts.Continue = objs.GetContinue()
+	}
+}
+
+// cleanTemplateObjects deletes the -template objects cpburner generated.
+// Unlike -resourceType cleanup it only touches objects with the cpburner
+// prefix, as deployments and custom resources in the namespace are rarely
+// all ours.
+func cleanTemplateObjects(config *rest.Config, templateName string) {
+	ctx := context.Background()
+	client, err := dynamic.NewForConfig(config)
+	if err != nil {
+		panic(err)
+	}
+	for _, ns := range targetNamespaces() {
+		resource := client.Resource(objectTemplates[templateName].gvr).Namespace(ns)
+		opts := metav1.ListOptions{TimeoutSeconds: &timeout, Limit: listLimit, LabelSelector: runSelector(), FieldSelector: fieldSelector}
+		for {
+			objs, err := resource.List(ctx, opts)
+			if err != nil {
+				panic(err)
+			}
+			for _, obj := range objs.Items {
+				if !isGenerated(obj.GetName()) {
+					continue
+				}
+				start := time.Now()
+				wctx, cancel := writeContext(ctx)
+				err := resource.Delete(wctx, obj.GetName(), deleteOptions())
+				cancel()
+				record(verbDelete, objectTemplates[templateName].gvr.Resource, start, err)
+			}
+			if objs.GetContinue() == "" {
+				break
+			}
+			opts.Continue = objs.GetContinue()
+		}
+	}
+}
@@ -0,0 +1,75 @@
+package main
+
+import (
+	"encoding/csv"
+	"encoding/json"
+	"os"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// timeseriesPoint is one -timeseriesInterval of a run.
+type timeseriesPoint struct {
+	SchemaVersion int       `json:"schemaVersion"`
+	Time          time.Time `json:"time"`
+	Elapsed       float64   `json:"elapsed"`
+	Requests      int64     `json:"requests"`
+	Failures      int64     `json:"failures"`
+	RequestRate   float64   `json:"requestRate"`
+	ErrorRate     float64   `json:"errorRate"`
+	MeanLatency   float64   `json:"meanLatency"`
+}
+
+// timeseriesFile receives a point every timeseriesInterval, as CSV if its
+// name ends in .csv and as NDJSON otherwise.
+type timeseriesFile struct {
+	csv     *csv.Writer
+	encoder *json.Encoder
+}
+
+func openTimeseries(path string) (*timeseriesFile, error) {
+	f, err := os.Create(path)
+	if err != nil {
+		return nil, err
+	}
+	if !strings.HasSuffix(path, ".csv") {
+		return &timeseriesFile{encoder: json.NewEncoder(f)}, nil
+	}
+	t := &timeseriesFile{csv: csv.NewWriter(f)}
+	t.csv.Write([]string{"time", "elapsed", "requests", "failures", "requestRate", "errorRate", "meanLatency"})
+	t.csv.Flush()
+	return t, t.csv.Error()
+}
+
+// run writes the points for the rest of the run.
+func (t *timeseriesFile) run(start time.Time) {
+	var w window
+	w.reset()
+	ticker := time.NewTicker(timeseriesInterval)
+	defer ticker.Stop()
+	for now := range ticker.C {
+		s := w.advance()
+		p := timeseriesPoint{
+			SchemaVersion: schemaVersion,
+			Time:          now,
+			Elapsed:       now.Sub(start).Seconds(),
+			Requests:      s.requests,
+			Failures:      s.failures,
+			RequestRate:   s.rate(),
+			ErrorRate:     float64(s.failures) / s.elapsed.Seconds(),
+			MeanLatency:   s.mean.Seconds(),
+		}
+		if t.encoder != nil {
+			t.encoder.Encode(p)
+			continue
+		}
+		t.csv.Write([]string{p.Time.Format(time.RFC3339Nano), formatFloat(p.Elapsed), strconv.FormatInt(p.Requests, 10), strconv.FormatInt(p.Failures, 10),
+			formatFloat(p.RequestRate), formatFloat(p.ErrorRate), formatFloat(p.MeanLatency)})
+		t.csv.Flush()
+	}
+}
+
+func formatFloat(f float64) string {
+	return strconv.FormatFloat(f, 'f', -1, 64)
+}
@@ -0,0 +1,132 @@
+package main
+
+import (
+	"context"
+	"net/http"
+	"strings"
+
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/codes"
+	"go.opentelemetry.io/otel/exporters/otlp/otlptrace/otlptracegrpc"
+	"go.opentelemetry.io/otel/propagation"
+	"go.opentelemetry.io/otel/sdk/resource"
+	sdktrace "go.opentelemetry.io/otel/sdk/trace"
+	semconv "go.opentelemetry.io/otel/semconv/v1.10.0"
+	"go.opentelemetry.io/otel/trace"
+)
+
+// setupTracing exports a span for every request to the OTLP gRPC collector
+// at tracingEndpoint. The trace context is propagated to the apiserver, so
+// with its APIServerTracing feature enabled both sides land in one trace.
+// The returned function flushes the spans not exported yet.
+func setupTracing(ctx context.Context) func() {
+	exporter, err := otlptracegrpc.New(ctx, otlptracegrpc.WithEndpoint(tracingEndpoint), otlptracegrpc.WithInsecure())
+	if err != nil {
+		panic(err)
+	}
+	provider := sdktrace.NewTracerProvider(
+		sdktrace.WithBatcher(exporter),
+		sdktrace.WithSampler(sdktrace.ParentBased(sdktrace.TraceIDRatioBased(tracingSampleRate))),
+		sdktrace.WithResource(resource.NewWithAttributes(semconv.SchemaURL,
+			semconv.ServiceNameKey.String("cpburner"), attribute.String("cpburner.run", globalPrefix))),
+	)
+	otel.SetTracerProvider(provider)
+	otel.SetTextMapPropagator(propagation.TraceContext{})
+	return func() {
+		provider.Shutdown(context.Background())
+	}
+}
+
+// tracingTransport wraps every request in a span carrying its Kubernetes
+// verb and resource.
+type tracingTransport struct {
+	next   http.RoundTripper
+	tracer trace.Tracer
+}
+
+func newTracingTransport(next http.RoundTripper) http.RoundTripper {
+	return &tracingTransport{next: next, tracer: otel.Tracer("cpburner")}
+}
+
+func (t *tracingTransport) RoundTrip(req *http.Request) (*http.Response, error) {
+	info := parseRequestPath(req)
+	ctx, span := t.tracer.Start(req.Context(), info.verb+" "+info.resource, trace.WithSpanKind(trace.SpanKindClient),
+		trace.WithAttributes(
+			attribute.String("k8s.verb", info.verb),
+			attribute.String("k8s.resource", info.resource),
+			attribute.String("k8s.subresource", info.subresource),
+			attribute.String("k8s.namespace", info.namespace),
+			semconv.HTTPMethodKey.String(req.Method),
+		))
+	defer span.End()
+	req = req.Clone(ctx)
+	otel.GetTextMapPropagator().Inject(ctx, propagation.HeaderCarrier(req.Header))
+	resp, err := t.next.RoundTrip(req)
+	if err != nil {
+		span.RecordError(err)
+		span.SetStatus(codes.Error, err.Error())
+		return nil, err
+	}
+	span.SetAttributes(semconv.HTTPStatusCodeKey.Int(resp.StatusCode))
+	if resp.StatusCode >= 400 {
+		span.SetStatus(codes.Error, resp.Status)
+	}
+	return resp, nil
+}
+
+type requestInfo struct {
+	verb, resource, subresource, namespace string
+}
+
+// parseRequestPath works out what the apiserver will see a request as from
+// its method and a path like /api/v1/namespaces/default/pods/name/status.
+func parseRequestPath(req *http.Request) requestInfo {
+	parts := strings.Split(strings.Trim(req.URL.Path, "/"), "/")
+	if len(parts) > 0 && parts[0] == "api" && len(parts) >= 2 {
+		parts = parts[2:]
+	} else if len(parts) > 0 && parts[0] == "apis" && len(parts) >= 3 {
+		parts = parts[3:]
+	} else {
+		return requestInfo{verb: strings.ToLower(req.Method), resource: req.URL.Path}
+	}
+	info := requestInfo{}
+	if len(parts) >= 3 && parts[0] == "namespaces" {
+		info.namespace, parts = parts[1], parts[2:]
+	}
+	named := len(parts) >= 2
+	if len(parts) >= 1 {
+		info.resource = parts[0]
+	}
+	if len(parts) >= 3 {
+		info.subresource = parts[2]
+	}
+	switch req.Method {
+	case http.MethodGet:
+		if req.URL.Query().Get("watch") == "true" {
+			info.verb = verbWatch
+		} else if named {
+			info.verb = verbGet
+		} else {
+			info.verb = verbList
+		}
+	case http.MethodPost:
+		info.verb = verbCreate
+	case http.MethodPut:
+		info.verb = verbUpdate
+	case http.MethodPatch:
+		info.verb = verbPatch
+		if req.Header.Get("Content-Type") == "application/apply-patch+yaml" {
+			info.verb = verbApply
+		}
+	case http.MethodDelete:
+		if named {
+			info.verb = verbDelete
+		} else {
+			info.verb = verbDeleteCollection
+		}
+	default:
+		info.verb = strings.ToLower(req.Method)
+	}
+	return info
+}
@@ -0,0 +1,148 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"sync/atomic"
+	"time"
+
+	"cpburner/pkg/burner"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime/schema"
+	"k8s.io/client-go/metadata"
+	"k8s.io/client-go/rest"
+)
+
+// expiresAnnotation carries the time after which 'clean -expired' may delete
+// an object, set on generated objects with -ttl
+const expiresAnnotation = "cpburner/expires"
+
+var (
+	// how long generated objects live, -ttl, no expiry if 0
+	ttl time.Duration
+	// let 'clean' delete only the expired objects, -expired
+	expiredOnly bool
+	// let 'clean' delete only the objects created longer ago, -olderThan
+	olderThan time.Duration
+)
+
+// expiryOf is the expiry of an object created now, empty without -ttl.
+func expiryOf() string {
+	if ttl == 0 {
+		return ""
+	}
+	return time.Now().Add(ttl).UTC().Format(time.RFC3339)
+}
+
+// expired tells whether the object with annotations expired by now. Objects
+// without a readable expiry never do.
+func expired(annotations map[string]string, now time.Time) bool {
+	expires, err := time.Parse(time.RFC3339, annotations[expiresAnnotation])
+	return err == nil && now.After(expires)
+}
+
+// filtersObjects tells whether 'clean' checks every object before deleting
+// it, with -expired or -olderThan.
+func filtersObjects() bool {
+	return expiredOnly || olderThan > 0
+}
+
+// deletable tells whether the object passes the -expired and -olderThan
+// filters of 'clean'.
+func deletable(obj metav1.PartialObjectMetadata, now time.Time) bool {
+	if expiredOnly && !expired(obj.Annotations, now) {
+		return false
+	}
+	return olderThan == 0 || now.Sub(obj.CreationTimestamp.Time) > olderThan
+}
+
+// cleanResource is what 'clean' deletes, the -template objects or those of
+// resourceType.
+func cleanResource(resourceType string) schema.GroupVersionResource {
+	if templateName != "" {
+		return objectTemplates[templateName].gvr
+	}
+	return burner.Generator(resourceType).Spec().GVR()
+}
+
+func metadataClient(config *rest.Config) metadata.Interface {
+	client, err := metadata.NewForConfig(config)
+	if err != nil {
+		panic(err)
+	}
+	return client
+}
+
+// deletableObjects pages through the objects clean selects in ns and returns
+// the names of the deletable ones. Template objects count only if cpburner
+// generated them, as cleanTemplateObjects does.
+func deletableObjects(ctx context.Context, client metadata.Interface, gvr schema.GroupVersionResource, ns string) ([]string, error) {
+	opts := metav1.ListOptions{TimeoutSeconds: &timeout, Limit: listLimit, LabelSelector: runSelector(), FieldSelector: fieldSelector}
+	now := time.Now()
+	names := []string{}
+	for {
+		var list *metav1.PartialObjectMetadataList
+		err := burner.Retry(ctx, func() (err error) {
+			start := time.Now()
+			list, err = client.Resource(gvr).Namespace(ns).List(ctx, opts)
+			record(verbList, gvr.Resource, start, err)
+			return err
+		})
+		if err != nil {
+			return nil, fmt.Errorf("listing the %s of namespace %s: %w", gvr.Resource, ns, err)
+		}
+		for _, obj := range list.Items {
+			if templateName != "" && !isGenerated(obj.Name) {
+				continue
+			}
+			if deletable(obj, now) {
+				names = append(names, obj.Name)
+			}
+		}
+		if list.Continue == "" {
+			return names, nil
+		}
+		opts.Continue = list.Continue
+	}
+}
+
+// deleteFiltered deletes the deletable objects of every target namespace one
+// by one and returns how many it deleted. Like the delete strategy it goes on
+// past deletes failing transiently and returns the first of those at the end.
+func deleteFiltered(ctx context.Context, config *rest.Config, resourceType string) (int64, error) {
+	client := metadataClient(config)
+	gvr := cleanResource(resourceType)
+	var deleted int64
+	var transientErr error
+	// the total grows as the namespaces are listed
+	atomic.StoreInt64(&cleanTotal, 0)
+	for _, ns := range targetNamespaces() {
+		names, err := deletableObjects(ctx, client, gvr, ns)
+		if err != nil {
+			return deleted, err
+		}
+		atomic.AddInt64(&cleanTotal, int64(len(names)))
+		for _, name := range names {
+			err := burner.Retry(ctx, func() error {
+				start := time.Now()
+				wctx, cancel := writeContext(ctx)
+				defer cancel()
+				err := client.Resource(gvr).Namespace(ns).Delete(wctx, name, deleteOptions())
+				record(verbDelete, gvr.Resource, start, err)
+				return err
+			})
+			if err == nil {
+				deleted++
+				recordDeleted(name)
+			} else if apierrors.IsNotFound(err) {
+				continue
+			} else if !burner.IsTransient(err) {
+				return deleted, fmt.Errorf("deleting %s %s/%s: %w", gvr.Resource, ns, name, err)
+			} else if transientErr == nil {
+				transientErr = fmt.Errorf("deleting %s %s/%s: %w", gvr.Resource, ns, name, err)
+			}
+		}
+	}
+	return deleted, transientErr
+}
@@ -0,0 +1,83 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"math"
+	"sort"
+	"time"
+
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/client-go/kubernetes"
+	"k8s.io/client-go/rest"
+)
+
+// coarse page sizes tried first, the best of them is then refined between
+// its neighbours
+var tuneLimits = []int64{50, 100, 250, 500, 1000, 2500, 5000, 10000}
+
+// tuneListLimit searches for the page size that lists the whole collection
+// fastest and prints it as a listLimit recommendation.
+func tuneListLimit(config *rest.Config, resourceType string) {
+	ctx := context.Background()
+	clientset, err := kubernetes.NewForConfig(config)
+	if err != nil {
+		panic(err)
+	}
+	results := map[int64]time.Duration{}
+	measure := func(limit int64) {
+		if _, ok := results[limit]; ok {
+			return
+		}
+		var total time.Duration
+		var items int64
+		for r := 0; r < tuneRounds; r++ {
+			start := time.Now()
+			items, err = countObjects(ctx, clientset, resourceType, metav1.ListOptions{TimeoutSeconds: &timeout, Limit: limit})
+			total += time.Since(start)
+			if err != nil {
+				panic(err)
+			}
+		}
+		results[limit] = total / time.Duration(tuneRounds)
+		fmt.Fprintf(out, "listLimit %d: full list of %d items in %s on average (%d pages)\n",
+			limit, items, results[limit], (items+limit-1)/limit)
+	}
+
+	for _, limit := range tuneLimits {
+		measure(limit)
+	}
+	best := bestLimit(results)
+	for i, limit := range tuneLimits {
+		if limit != best {
+			continue
+		}
+		if i > 0 {
+			measure(geometricMean(tuneLimits[i-1], limit))
+		}
+		if i < len(tuneLimits)-1 {
+			measure(geometricMean(limit, tuneLimits[i+1]))
+		}
+	}
+	best = bestLimit(results)
+	fmt.Fprintf(out, "recommended listLimit for %s: %d (full list in %s)\n", resourceType, best, results[best])
+}
+
+func bestLimit(results map[int64]time.Duration) int64 {
+	limits := []int64{}
+	for limit := range results {
+		limits = append(limits, limit)
+	}
+	sort.Slice(limits, func(i, j int) bool { return limits[i] < limits[j] })
+	best := limits[0]
+	for _, limit := range limits {
+		if results[limit] < results[best] {
+			best = limit
+		}
+	}
+	return best
+}
+
+func geometricMean(a, b int64) int64 {
+	return int64(math.Sqrt(float64(a) * float64(b)))
+}
@@ -0,0 +1,76 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"sort"
+	"strings"
+
+	"k8s.io/client-go/kubernetes"
+	"k8s.io/client-go/rest"
+)
+
+// how many missing or extra names verify prints
+const verifyExamples = 10
+
+// verify lists the objects of the create run with prefix runPrefix and
+// compares them with the names that run should have created, given the same
+// -resourceCount, -concurrency and -nameStrategy. uuid names cannot be
+// predicted, for them only the count is compared. It returns whether the
+// cluster matches, or why it could not list the objects.
+func verify(config *rest.Config, resourceCount int, resourceType string, runPrefix string) (bool, error) {
+	ctx := context.Background()
+	clientset, err := kubernetes.NewForConfig(config)
+	if err != nil {
+		panic(err)
+	}
+	all, err := listGeneratedNames(ctx, clientset, resourceType)
+	if err != nil {
+		return false, err
+	}
+	found := map[string]bool{}
+	for _, name := range all {
+		if strings.HasPrefix(name, runPrefix+"-") {
+			found[name] = true
+		}
+	}
+
+	count := int(resourceCount / concurrency)
+	expected := count * concurrency
+	if nameStrategy == nameStrategyUUID {
+		fmt.Fprintf(out, "verify %s run %s: expected %d objects, found %d\n", resourceType, runPrefix, expected, len(found))
+		return len(found) == expected, nil
+	}
+	missing := []string{}
+	for i := 0; i < concurrency; i++ {
+		prefix := fmt.Sprintf("%s-%d", runPrefix, i)
+		for j := 0; j < count; j++ {
+			name := objectName(prefix, j)
+			if found[name] {
+				delete(found, name)
+			} else {
+				missing = append(missing, name)
+			}
+		}
+	}
+	extra := []string{}
+	for name := range found {
+		extra = append(extra, name)
+	}
+	sort.Strings(extra)
+
+	fmt.Fprintf(out, "verify %s run %s: expected %d objects, %d missing, %d extra\n", resourceType, runPrefix, expected, len(missing), len(extra))
+	printExamples("missing", missing)
+	printExamples("extra", extra)
+	return len(missing) == 0 && len(extra) == 0, nil
+}
+
+func printExamples(what string, names []string) {
+	for i, name := range names {
+		if i == verifyExamples {
+			fmt.Fprintf(out, "  ... and %d more %s\n", len(names)-verifyExamples, what)
+			return
+		}
+		fmt.Fprintf(out, "  %s: %s\n", what, name)
+	}
+}
@@ -0,0 +1,254 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"sort"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	"k8s.io/apimachinery/pkg/api/meta"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/watch"
+	"k8s.io/client-go/kubernetes"
+	"k8s.io/client-go/rest"
+)
+
+// how often 'watch' prints the event rates of its watchers
+const watcherStatsInterval = 10 * time.Second
+
+var (
+	// resourceVersions and label selectors cycled over the watchers of
+	// 'watch', from -watchResourceVersion and -watchLabelSelectors
+	watchResourceVersions []string
+	watchLabelSelectors   []string
+
+	watchersMu sync.Mutex
+	// every watcher of 'watch', for its statistics
+	watcherFleet []*watcherStats
+)
+
+// watcherStats follows one watcher through its restarts.
+type watcherStats struct {
+	namespace string
+	// resourceVersion the watcher starts from
+	startRV string
+	// resourceVersion the watcher starts over from, startRV until that is
+	// too old itself
+	restartRV string
+	selector  string
+	started   time.Time
+	events    int64
+	restarts  int64
+}
+
+// newWatcher is the i-th watcher, with the resourceVersion and label
+// selector that fall to it.
+func newWatcher(i int) *watcherStats {
+	rv := watchResourceVersions[i%len(watchResourceVersions)]
+	s := &watcherStats{namespace: namespaceAt(i), startRV: rv, restartRV: rv, selector: selector(), started: time.Now()}
+	if len(watchLabelSelectors) > 0 {
+		s.selector = joinSelectors(s.selector, watchLabelSelectors[i%len(watchLabelSelectors)])
+	}
+	return s
+}
+
+// expired returns the resourceVersion to start over from once rv is too
+// old. A start that is too old itself, as an explicit -watchResourceVersion
+// the server compacted away, would expire again and again, the watcher then
+// starts over from the latest resourceVersion.
+func (s *watcherStats) expired(rv string) string {
+	if rv == s.restartRV {
+		s.restartRV = ""
+	}
+	return s.restartRV
+}
+
+func joinSelectors(a, b string) string {
+	if a == "" || b == "" {
+		return a + b
+	}
+	return a + "," + b
+}
+
+// watchAction opens watchers watches spread over concurrency clientsets and
+// counts the events they receive, until the end of a -duration run or the
+// process is killed.
+func watchAction(config *rest.Config, resourceType string) {
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	if duration > 0 {
+		ctx, cancel = context.WithDeadline(ctx, deadline)
+		defer cancel()
+	}
+	go func() {
+		for ctx.Err() == nil && !stopRequested() {
+			time.Sleep(time.Second)
+		}
+		cancel()
+	}()
+	go printWatcherRates(ctx)
+	if bookmarkProbeInterval > 0 {
+		go probeResourceVersions(ctx, config, resourceType)
+	}
+	wg := sync.WaitGroup{}
+	for i := 0; i < concurrency; i++ {
+		clientset, err := kubernetes.NewForConfig(workerConfig(config))
+		if err != nil {
+			panic(err)
+		}
+		for j := i; j < watchers; j += concurrency {
+			s := newWatcher(j)
+			watchersMu.Lock()
+			watcherFleet = append(watcherFleet, s)
+			watchersMu.Unlock()
+			wg.Add(1)
+			go func() {
+				defer wg.Done()
+				runWatcher(ctx, clientset, resourceType, s)
+			}()
+		}
+	}
+	wg.Wait()
+}
+
+// runWatcher keeps one watch open, resuming from the last seen
+// resourceVersion when the server closes it and starting over from the
+// watcher's start when that is too old.
+func runWatcher(ctx context.Context, clientset *kubernetes.Clientset, resourceType string, s *watcherStats) {
+	rv := s.startRV
+	for ctx.Err() == nil {
+		start := time.Now()
+		w, err := watchResources(ctx, clientset, resourceType, s.namespace, metav1.ListOptions{
+			LabelSelector:       s.selector,
+			FieldSelector:       fieldSelector,
+			ResourceVersion:     rv,
+			AllowWatchBookmarks: true,
+		})
+		if ctx.Err() != nil {
+			return
+		}
+		if isExpired(err) {
+			rv = s.expired(rv)
+			continue
+		}
+		if err != nil {
+			time.Sleep(time.Second)
+			continue
+		}
+		rv = countWatchEvents(w, rv, resourceType, start, s)
+		if ctx.Err() == nil {
+			atomic.AddInt64(&s.restarts, 1)
+		}
+	}
+}
+
+func isExpired(err error) bool {
+	return apierrors.IsResourceExpired(err) || apierrors.IsGone(err)
+}
+
+// countWatchEvents counts the events of w for s until the watch ends and
+// returns the resourceVersion to resume from. Error events are recorded as
+// failures of the watch opened at start.
+func countWatchEvents(w watch.Interface, rv string, resourceType string, start time.Time, s *watcherStats) string {
+	defer w.Stop()
+	// bookmarks are timed within one watch, a restart starts over
+	var lastBookmark time.Time
+	for e := range w.ResultChan() {
+		switch e.Type {
+		case watch.Error:
+			err := apierrors.FromObject(e.Object)
+			if isExpired(err) {
+				return s.expired(rv)
+			}
+			record(verbWatch, resourceName(resourceType), start, err)
+			continue
+		case watch.Bookmark:
+			if obj, err := meta.Accessor(e.Object); err == nil {
+				observeBookmark(lastBookmark, obj.GetResourceVersion())
+			}
+			lastBookmark = time.Now()
+		default:
+			recordWatchEvent()
+			atomic.AddInt64(&s.events, 1)
+		}
+		if obj, err := meta.Accessor(e.Object); err == nil {
+			rv = obj.GetResourceVersion()
+		}
+	}
+	return rv
+}
+
+// printWatcherRates prints how many events per second the watchers received
+// over the last watcherStatsInterval, lowest, median and highest, until ctx
+// is done. A watcher far below the others is one the apiserver falls behind
+// on.
+func printWatcherRates(ctx context.Context) {
+	last := map[*watcherStats]int64{}
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-time.After(watcherStatsInterval):
+		}
+		watchersMu.Lock()
+		rates := make([]float64, 0, len(watcherFleet))
+		for _, s := range watcherFleet {
+			events := atomic.LoadInt64(&s.events)
+			rates = append(rates, float64(events-last[s])/watcherStatsInterval.Seconds())
+			last[s] = events
+		}
+		watchersMu.Unlock()
+		if len(rates) == 0 {
+			continue
+		}
+		sort.Float64s(rates)
+		fmt.Fprintf(out, "%d watchers, events/s per watcher: min %.1f, median %.1f, max %.1f\n",
+			len(rates), rates[0], rates[len(rates)/2], rates[len(rates)-1])
+	}
+}
+
+// watcherSummary is what one watcher of 'watch' received.
+type watcherSummary struct {
+	Watcher         int     `json:"watcher"`
+	Namespace       string  `json:"namespace"`
+	ResourceVersion string  `json:"resourceVersion"`
+	LabelSelector   string  `json:"labelSelector,omitempty"`
+	Events          int64   `json:"events"`
+	EventsPerSecond float64 `json:"eventsPerSecond"`
+	Restarts        int64   `json:"restarts"`
+}
+
+func watcherSummaries() []watcherSummary {
+	watchersMu.Lock()
+	defer watchersMu.Unlock()
+	summaries := []watcherSummary{}
+	for i, s := range watcherFleet {
+		events := atomic.LoadInt64(&s.events)
+		summaries = append(summaries, watcherSummary{
+			Watcher:         i,
+			Namespace:       s.namespace,
+			ResourceVersion: s.startRV,
+			LabelSelector:   s.selector,
+			Events:          events,
+			EventsPerSecond: float64(events) / time.Since(s.started).Seconds(),
+			Restarts:        atomic.LoadInt64(&s.restarts),
+		})
+	}
+	return summaries
+}
+
+// printWatchers prints the events every watcher received with
+// -perWorkerStats, the watchers being the workers of 'watch'.
+func printWatchers(w io.Writer) {
+	if !perWorkerStats {
+		return
+	}
+	for _, s := range watcherSummaries() {
+		fmt.Fprintf(w, "  watcher %d in %s from resourceVersion %q selecting %q: %d events, %.1f/s, %d restarts\n",
+			s.Watcher, s.Namespace, s.ResourceVersion, s.LabelSelector, s.Events, s.EventsPerSecond, s.Restarts)
+	}
+}
@@ -0,0 +1,141 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"time"
+
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	"k8s.io/apimachinery/pkg/api/meta"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/watch"
+	"k8s.io/client-go/kubernetes"
+	"k8s.io/client-go/kubernetes/scheme"
+)
+
+const (
+	listMethodChunked   = "chunked"
+	listMethodWatchList = "watchlist"
+	listMethodCompare   = "compare"
+
+	// labels the streaming lists apart from the chunked ones; the apiserver
+	// sees a watch
+	verbWatchList = "watchlist"
+
+	// annotation of the bookmark ending the initial events of a watchlist
+	initialEventsEndAnnotation = "k8s.io/initial-events-end"
+)
+
+var (
+	// how 'list' lists, -listMethod
+	listMethod string
+
+	// how long whole lists took with -listMethod compare, every page of a
+	// chunked list included
+	chunkedListDurations histogram
+	watchListDurations   histogram
+)
+
+// listComparison compares the two list mechanisms of -listMethod compare.
+type listComparison struct {
+	Chunked   latencySummary `json:"chunked"`
+	WatchList latencySummary `json:"watchList"`
+}
+
+// watchList lists the objects of ns as a WatchList does, with a watch
+// sending the current objects as ADDED events first, and returns how many it
+// got once the bookmark after them arrived. The WatchList feature must be
+// enabled on the apiserver. ListOptions of this client-go predates
+// sendInitialEvents, the parameter is set by hand.
+func watchList(ctx context.Context, clientset *kubernetes.Clientset, ns string, resource string) (int, error) {
+	opts := metav1.ListOptions{
+		Watch:                true,
+		AllowWatchBookmarks:  true,
+		LabelSelector:        selector(),
+		TimeoutSeconds:       &timeout,
+		ResourceVersion:      listResourceVersion,
+		ResourceVersionMatch: metav1.ResourceVersionMatchNotOlderThan,
+	}
+	w, err := clientset.CoreV1().RESTClient().Get().
+		Namespace(ns).
+		Resource(resource).
+		VersionedParams(&opts, scheme.ParameterCodec).
+		Param("sendInitialEvents", "true").
+		Watch(ctx)
+	if err != nil {
+		return 0, err
+	}
+	defer w.Stop()
+	count := 0
+	for e := range w.ResultChan() {
+		switch e.Type {
+		case watch.Added:
+			count++
+		case watch.Bookmark:
+			if obj, err := meta.Accessor(e.Object); err == nil && obj.GetAnnotations()[initialEventsEndAnnotation] == "true" {
+				return count, nil
+			}
+		case watch.Error:
+			return count, apierrors.FromObject(e.Object)
+		}
+	}
+	return count, fmt.Errorf("watch ended after %d initial events without the bookmark ending them: %w", count, io.ErrUnexpectedEOF)
+}
+
+// recordedWatchList is watchList, recorded as one request.
+func recordedWatchList(ctx context.Context, clientset *kubernetes.Clientset, ns string, resource string) error {
+	start := time.Now()
+	_, err := watchList(ctx, clientset, ns, resource)
+	record(verbWatchList, resource, start, err)
+	if err != nil && isWatchListUnsupported(err) {
+		return fmt.Errorf("watchlist of the %s of namespace %s, is the WatchList feature gate of the apiserver enabled? %w", resource, ns, err)
+	} else if err != nil {
+		return fmt.Errorf("watchlist of the %s of namespace %s: %w", resource, ns, err)
+	}
+	return nil
+}
+
+// compareLists lists ns both ways, a WatchList first and a chunked list of
+// -listLimit pages next, and times both as a whole.
+func compareLists(ctx context.Context, clientset *kubernetes.Clientset, resourceType string, ns string) error {
+	resource := resourceName(resourceType)
+	start := time.Now()
+	if err := recordedWatchList(ctx, clientset, ns, resource); err != nil {
+		return err
+	}
+	watchListDurations.observe(time.Since(start))
+	start = time.Now()
+	if _, err := countObjectsIn(ctx, clientset, resourceType, ns, metav1.ListOptions{TimeoutSeconds: &timeout, LabelSelector: selector()}); err != nil {
+		return err
+	}
+	chunkedListDurations.observe(time.Since(start))
+	return nil
+}
+
+func listComparisons() *listComparison {
+	if listMethod != listMethodCompare {
+		return nil
+	}
+	return &listComparison{Chunked: chunkedListDurations.summary(), WatchList: watchListDurations.summary()}
+}
+
+// printListComparison prints how long whole lists took both ways with
+// -listMethod compare.
+func printListComparison(w io.Writer) {
+	if listMethod != listMethodCompare {
+		return
+	}
+	fmt.Fprintf(w, "chunked lists: %s\n", &chunkedListDurations)
+	fmt.Fprintf(w, "watchlists: %s\n", &watchListDurations)
+	if chunked := chunkedListDurations.mean(); chunked > 0 {
+		fmt.Fprintf(w, "watchlists take %.2f times as long as chunked lists on average\n", float64(watchListDurations.mean())/float64(chunked))
+	}
+}
+
+// isWatchListUnsupported tells whether err is an apiserver refusing a
+// WatchList, as those without the feature gate do.
+func isWatchListUnsupported(err error) bool {
+	return apierrors.IsInvalid(err) || apierrors.IsBadRequest(err) || errors.Is(err, io.ErrUnexpectedEOF)
+}
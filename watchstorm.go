@@ -0,0 +1,221 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"sync"
+	"time"
+
+	"cpburner/pkg/burner"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	"k8s.io/apimachinery/pkg/api/meta"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/watch"
+	"k8s.io/client-go/kubernetes"
+	"k8s.io/client-go/rest"
+)
+
+// stormTracker broadcasts storm triggers to all watchers and measures how
+// long it takes until every watcher has relisted and is watching again.
+// Generation 0 is the initial establishment of the watches.
+type stormTracker struct {
+	mu         sync.Mutex
+	watchers   int
+	storms     int
+	gen        int
+	trigger    chan struct{}
+	start      time.Time
+	rewatched  map[int]bool
+	latencySum time.Duration
+	errors     int
+	done       chan struct{}
+}
+
+func newStormTracker(watchers int, storms int) *stormTracker {
+	return &stormTracker{
+		watchers:  watchers,
+		storms:    storms,
+		trigger:   make(chan struct{}),
+		start:     time.Now(),
+		rewatched: map[int]bool{},
+		done:      make(chan struct{}),
+	}
+}
+
+// current returns the generation a watcher is catching up with, and the
+// channel that will be closed by the next storm.
+func (s *stormTracker) current() (int, <-chan struct{}) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.gen, s.trigger
+}
+
+func (s *stormTracker) fire() int {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if len(s.rewatched) < s.watchers {
+		fmt.Fprintf(out, "storm %d fired before storm %d was absorbed (%d/%d watchers re-established)\n", s.gen+1, s.gen, len(s.rewatched), s.watchers)
+	}
+	close(s.trigger)
+	s.trigger = make(chan struct{})
+	s.gen++
+	s.start = time.Now()
+	s.rewatched = map[int]bool{}
+	s.latencySum = 0
+	s.errors = 0
+	return s.gen
+}
+
+func (s *stormTracker) failed(gen int) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if gen == s.gen {
+		s.errors++
+	}
+}
+
+func (s *stormTracker) reestablished(gen int, watcher int) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if gen != s.gen || s.rewatched[watcher] {
+		return
+	}
+	s.rewatched[watcher] = true
+	s.latencySum += time.Since(s.start)
+	if len(s.rewatched) < s.watchers {
+		return
+	}
+	what := fmt.Sprintf("storm %d", s.gen)
+	if s.gen == 0 {
+		what = "initial watch establishment"
+	}
+	fmt.Fprintf(out, "%s: %d watchers relisted and re-watched in %s (mean %s), %d failed attempts\n",
+		what, s.watchers, time.Since(s.start), s.latencySum/time.Duration(s.watchers), s.errors)
+	if s.storms > 0 && s.gen == s.storms {
+		close(s.done)
+	}
+}
+
+// watchStorm holds concurrency watches open and on every trigger drops all of
+// them at once, the way an LB or apiserver failover would, so that every
+// watcher relists and re-watches simultaneously.
+func watchStorm(config *rest.Config, resourceType string) {
+	ctx := context.Background()
+	tracker := newStormTracker(concurrency, storms)
+	for i := 0; i < concurrency; i++ {
+		go func(watcher int) {
+			clientset, err := kubernetes.NewForConfig(workerConfig(config))
+			if err != nil {
+				panic(err)
+			}
+			runStormWatcher(ctx, clientset, resourceType, tracker, watcher)
+		}(i)
+	}
+
+	if stormAddr != "" {
+		mux := http.NewServeMux()
+		mux.HandleFunc("/storm", func(w http.ResponseWriter, r *http.Request) {
+			if r.Method != http.MethodPost {
+				http.Error(w, "use POST to trigger a storm", http.StatusMethodNotAllowed)
+				return
+			}
+			fmt.Fprintf(w, "storm %d triggered\n", tracker.fire())
+		})
+		go func() {
+			if err := http.ListenAndServe(stormAddr, mux); err != nil {
+				panic(err)
+			}
+		}()
+	}
+	if stormInterval > 0 {
+		go func() {
+			for {
+				time.Sleep(stormInterval)
+				tracker.fire()
+			}
+		}()
+	}
+	<-tracker.done
+}
+
+func runStormWatcher(ctx context.Context, clientset *kubernetes.Clientset, resourceType string, tracker *stormTracker, watcher int) {
+	for {
+		gen, trigger := tracker.current()
+		rv, err := relist(ctx, clientset, resourceType, namespaceAt(watcher))
+		if err != nil {
+			tracker.failed(gen)
+			time.Sleep(time.Second)
+			continue
+		}
+		for rv != "" {
+			w, err := watchResources(ctx, clientset, resourceType, namespaceAt(watcher), metav1.ListOptions{ResourceVersion: rv, AllowWatchBookmarks: true})
+			if err != nil {
+				tracker.failed(gen)
+				break
+			}
+			tracker.reestablished(gen, watcher)
+			rv = drainWatch(w, trigger, rv)
+		}
+	}
+}
+
+// drainWatch consumes w until it is closed by the server or trigger fires.
+// It returns the resourceVersion to resume watching from, or "" when the
+// watcher has to relist.
+func drainWatch(w watch.Interface, trigger <-chan struct{}, rv string) string {
+	defer w.Stop()
+	for {
+		select {
+		case <-trigger:
+			return ""
+		case e, ok := <-w.ResultChan():
+			if !ok {
+				return rv
+			}
+			if e.Type == watch.Error {
+				if apierrors.IsResourceExpired(apierrors.FromObject(e.Object)) || apierrors.IsGone(apierrors.FromObject(e.Object)) {
+					return ""
+				}
+				continue
+			}
+			if e.Type != watch.Bookmark {
+				recordWatchEvent()
+			}
+			if obj, err := meta.Accessor(e.Object); err == nil {
+				rv = obj.GetResourceVersion()
+			}
+		}
+	}
+}
+
+// relist pages through all objects like an informer does on startup and
+// returns the resourceVersion to start watching from.
+func relist(ctx context.Context, clientset *kubernetes.Clientset, resourceType string, ns string) (string, error) {
+	rv := ""
+	continueString := ""
+	for {
+		opts := metav1.ListOptions{TimeoutSeconds: &timeout, Limit: listLimit, Continue: continueString}
+		start := time.Now()
+		_, listMeta, err := burner.Generator(resourceType).List(ctx, clientset, ns, opts)
+		record(verbList, resourceName(resourceType), start, err)
+		if err != nil {
+			return "", err
+		}
+		if rv == "" {
+			rv = listMeta.ResourceVersion
+		}
+		if listMeta.Continue == "" {
+			return rv, nil
+		}
+		continueString = listMeta.Continue
+	}
+}
+
+// watchResources starts a watch in namespace ns and records how long
+// establishing it took.
+func watchResources(ctx context.Context, clientset *kubernetes.Clientset, resourceType string, ns string, opts metav1.ListOptions) (w watch.Interface, err error) {
+	start := time.Now()
+	defer func() { record(verbWatch, resourceName(resourceType), start, err) }()
+	return burner.Generator(resourceType).Watch(ctx, clientset, ns, opts)
+}
@@ -0,0 +1,88 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/client-go/kubernetes"
+	"k8s.io/client-go/rest"
+)
+
+func parseIntList(s string) ([]int, error) {
+	values := []int{}
+	for _, part := range strings.Split(s, ",") {
+		v, err := strconv.Atoi(strings.TrimSpace(part))
+		if err != nil || v < 1 {
+			return nil, fmt.Errorf("invalid value %q", part)
+		}
+		values = append(values, v)
+	}
+	return values, nil
+}
+
+// sweepWatchTimeouts runs every combination of watcher count and watch
+// timeoutSeconds for sweepDuration and reports how often the watches had to
+// be re-established and how long establishing them took.
+func sweepWatchTimeouts(config *rest.Config, resourceType string, watcherCounts []int, timeouts []int) {
+	clientsets := make([]*kubernetes.Clientset, concurrency)
+	for i := range clientsets {
+		clientset, err := kubernetes.NewForConfig(workerConfig(config))
+		if err != nil {
+			panic(err)
+		}
+		clientsets[i] = clientset
+	}
+	for _, n := range watcherCounts {
+		for _, t := range timeouts {
+			stats := sweepWatches(clientsets, resourceType, n, int64(t))
+			stats.mu.Lock()
+			rate := float64(stats.count) / sweepDuration.Seconds()
+			stats.mu.Unlock()
+			fmt.Fprintf(out, "watchers %d, timeoutSeconds %d: %.2f watch establishments/s, %s\n", n, t, rate, stats)
+		}
+	}
+}
+
+func sweepWatches(clientsets []*kubernetes.Clientset, resourceType string, watcherCount int, timeoutSeconds int64) *latencyStats {
+	ctx, cancel := context.WithTimeout(context.Background(), sweepDuration)
+	defer cancel()
+	stats := &latencyStats{}
+	wg := sync.WaitGroup{}
+	for i := 0; i < watcherCount; i++ {
+		wg.Add(1)
+		go func(clientset *kubernetes.Clientset, s *watcherStats) {
+			defer wg.Done()
+			rv := s.startRV
+			for ctx.Err() == nil {
+				start := time.Now()
+				w, err := watchResources(ctx, clientset, resourceType, s.namespace, metav1.ListOptions{
+					LabelSelector:       s.selector,
+					FieldSelector:       fieldSelector,
+					ResourceVersion:     rv,
+					TimeoutSeconds:      &timeoutSeconds,
+					AllowWatchBookmarks: true,
+				})
+				if ctx.Err() != nil {
+					return
+				}
+				stats.observe(time.Since(start), err)
+				if isExpired(err) {
+					rv = s.expired(rv)
+					continue
+				}
+				if err != nil {
+					time.Sleep(time.Second)
+					continue
+				}
+				rv = countWatchEvents(w, rv, resourceType, start, s)
+			}
+		}(clientsets[i%len(clientsets)], newWatcher(i))
+	}
+	wg.Wait()
+	return stats
+}
@@ -0,0 +1,90 @@
+package main
+
+import (
+	"fmt"
+	"io"
+	"net/http"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"k8s.io/client-go/rest"
+)
+
+// workerStats is what one worker's clientset went through, measured at the
+// transport from sending a request until its response body is closed.
+// Watches are not included.
+type workerStats struct {
+	failures  int64
+	latencies histogram
+}
+
+var (
+	workersMu sync.Mutex
+	workers   []*workerStats
+)
+
+// workerConfig gives a worker a config of its own, so with -perWorkerStats
+// its requests are told apart from those of the other workers. Workers are
+// numbered in the order they are started.
+func workerConfig(config *rest.Config) *rest.Config {
+	if !perWorkerStats {
+		return config
+	}
+	stats := &workerStats{}
+	workersMu.Lock()
+	workers = append(workers, stats)
+	workersMu.Unlock()
+	c := rest.CopyConfig(config)
+	c.Wrap(func(next http.RoundTripper) http.RoundTripper {
+		return &workerTracker{next: next, stats: stats}
+	})
+	return c
+}
+
+type workerTracker struct {
+	next  http.RoundTripper
+	stats *workerStats
+}
+
+func (t *workerTracker) RoundTrip(req *http.Request) (*http.Response, error) {
+	if req.URL.Query().Get("watch") == "true" {
+		return t.next.RoundTrip(req)
+	}
+	start := time.Now()
+	resp, err := t.next.RoundTrip(req)
+	if err != nil || resp.StatusCode >= 400 {
+		atomic.AddInt64(&t.stats.failures, 1)
+	}
+	if err != nil {
+		t.stats.latencies.observe(time.Since(start))
+		return nil, err
+	}
+	resp.Body = &releasingBody{ReadCloser: resp.Body, release: func() { t.stats.latencies.observe(time.Since(start)) }}
+	return resp, nil
+}
+
+// workerSummary is the latency of one worker's requests in seconds.
+type workerSummary struct {
+	Worker   int   `json:"worker"`
+	Failures int64 `json:"failures"`
+	latencySummary
+}
+
+func workerSummaries() []workerSummary {
+	workersMu.Lock()
+	defer workersMu.Unlock()
+	summaries := []workerSummary{}
+	for i, w := range workers {
+		summaries = append(summaries, workerSummary{Worker: i, Failures: atomic.LoadInt64(&w.failures), latencySummary: w.latencies.summary()})
+	}
+	return summaries
+}
+
+func printWorkers(w io.Writer) {
+	workersMu.Lock()
+	defer workersMu.Unlock()
+	for i, stats := range workers {
+		fmt.Fprintf(w, "  worker %d: %d failures, %s\n", i, atomic.LoadInt64(&stats.failures), &stats.latencies)
+	}
+}